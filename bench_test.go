@@ -0,0 +1,103 @@
+package psd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var benchFixtures = []string{
+	"example.psd",
+	"example.psb",
+	"blendmodes.psd",
+	"empty-layer.psd",
+	"pixel.psd",
+}
+
+// BenchmarkParse parses each fixture from disk, reading through *os.File
+func BenchmarkParse(b *testing.B) {
+	for _, name := range benchFixtures {
+		path := filepath.Join("testdata", name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				psd, err := New(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := psd.Parse(); err != nil {
+					b.Fatal(err)
+				}
+				psd.Close()
+			}
+		})
+	}
+}
+
+// BenchmarkParseBytes parses each fixture from memory
+func BenchmarkParseBytes(b *testing.B) {
+	for _, name := range benchFixtures {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				psd, err := NewFromBytes(data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := psd.Parse(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParseLayers parses only the layer records, where the integer
+// readers dominate
+func BenchmarkParseLayers(b *testing.B) {
+	for _, name := range benchFixtures {
+		path := filepath.Join("testdata", name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				psd, err := New(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				opts := ParseOptions{SkipImage: true, LazyChannels: true}
+				if err := psd.ParseWithOptions(opts); err != nil {
+					b.Fatal(err)
+				}
+				psd.Close()
+			}
+		})
+	}
+}
+
+// BenchmarkParseConcurrency compares serial and concurrent channel decoding
+func BenchmarkParseConcurrency(b *testing.B) {
+	for _, concurrency := range []int{1, 0} {
+		name := "serial"
+		if concurrency == 0 {
+			name = "default"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				psd, err := New("testdata/example.psd")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := psd.ParseWithOptions(ParseOptions{Concurrency: concurrency}); err != nil {
+					b.Fatal(err)
+				}
+				psd.Close()
+			}
+		})
+	}
+}
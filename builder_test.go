@@ -0,0 +1,371 @@
+package psd
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+)
+
+// testDoc describes a synthetic document that build serializes into PSD or
+// PSB bytes, so tests can cover format variants without binary fixtures.
+type testDoc struct {
+	version  uint16 // 1 = PSD, 2 = PSB
+	channels uint16
+	width    uint32
+	height   uint32
+	depth    uint16
+	mode     uint16
+
+	colorData []byte
+	resources []testResource
+
+	layers      []testLayer // in file order (bottom to top)
+	mergedAlpha bool        // write a negative layer count
+	layersKey   string      // store layers in a global block such as "Lr16"
+
+	composite            [][]byte // uncompressed samples per channel
+	compositeCompression uint16
+}
+
+type testResource struct {
+	id   uint16
+	data []byte
+}
+
+type testLayer struct {
+	name                     string
+	top, left, bottom, right int32
+	blendMode                string
+	opacity                  uint8
+	flags                    uint8
+	mask                     *LayerMaskData
+	channels                 []testChannel
+	info                     []testInfo
+}
+
+type testChannel struct {
+	id          int16
+	compression uint16
+	data        []byte // uncompressed samples
+}
+
+type testInfo struct {
+	key  string
+	data []byte
+}
+
+func (d *testDoc) big() bool {
+	return d.version == 2
+}
+
+// rowBytes returns the number of bytes in one scanline of width samples
+func (d *testDoc) rowBytes(width int) int {
+	if d.depth == 1 {
+		return (width + 7) / 8
+	}
+	return width * int(d.depth) / 8
+}
+
+func (d *testDoc) build() []byte {
+	buf := new(bytes.Buffer)
+
+	// Header
+	buf.WriteString("8BPS")
+	writeBE(buf, d.version)
+	buf.Write(make([]byte, 6))
+	writeBE(buf, d.channels)
+	writeBE(buf, d.height)
+	writeBE(buf, d.width)
+	writeBE(buf, d.depth)
+	writeBE(buf, d.mode)
+
+	// Color mode data
+	writeBE(buf, uint32(len(d.colorData)))
+	buf.Write(d.colorData)
+
+	// Image resources
+	res := new(bytes.Buffer)
+	for _, r := range d.resources {
+		res.WriteString("8BIM")
+		writeBE(res, r.id)
+		res.Write([]byte{0, 0}) // empty Pascal name, padded
+		writeBE(res, uint32(len(r.data)))
+		res.Write(r.data)
+		if len(r.data)%2 != 0 {
+			res.WriteByte(0)
+		}
+	}
+	writeBE(buf, uint32(res.Len()))
+	buf.Write(res.Bytes())
+
+	// Layer and mask information
+	layerMask := new(bytes.Buffer)
+	if len(d.layers) > 0 && d.layersKey != "" {
+		layerInfo := d.buildLayerInfo()
+		d.writeLength(layerMask, 0)
+		writeBE(layerMask, uint32(0)) // global layer mask info
+		layerMask.WriteString("8BIM")
+		layerMask.WriteString(d.layersKey)
+		d.writeLength(layerMask, uint64(len(layerInfo)))
+		layerMask.Write(layerInfo)
+	} else if len(d.layers) > 0 {
+		layerInfo := d.buildLayerInfo()
+		d.writeLength(layerMask, uint64(len(layerInfo)))
+		layerMask.Write(layerInfo)
+		writeBE(layerMask, uint32(0)) // global layer mask info
+	}
+	d.writeLength(buf, uint64(layerMask.Len()))
+	buf.Write(layerMask.Bytes())
+
+	// Image data
+	writeBE(buf, d.compositeCompression)
+	width, height := int(d.width), int(d.height)
+	switch d.compositeCompression {
+	case 0:
+		for _, ch := range d.composite {
+			buf.Write(ch)
+		}
+	case 1:
+		var counts, rows bytes.Buffer
+		for _, ch := range d.composite {
+			for _, row := range encodeRLERows(ch, d.rowBytes(width), height) {
+				d.writeRLECount(&counts, len(row))
+				rows.Write(row)
+			}
+		}
+		buf.Write(counts.Bytes())
+		buf.Write(rows.Bytes())
+	case 2, 3:
+		var planes []byte
+		for _, ch := range d.composite {
+			planes = append(planes, ch...)
+		}
+		buf.Write(d.encodeZIP(planes, d.rowBytes(width), d.compositeCompression == 3))
+	}
+
+	return buf.Bytes()
+}
+
+func (d *testDoc) buildLayerInfo() []byte {
+	records := new(bytes.Buffer)
+	channelData := new(bytes.Buffer)
+
+	count := int16(len(d.layers))
+	if d.mergedAlpha {
+		count = -count
+	}
+	writeBE(records, count)
+
+	for _, l := range d.layers {
+		writeBE(records, l.top)
+		writeBE(records, l.left)
+		writeBE(records, l.bottom)
+		writeBE(records, l.right)
+
+		writeBE(records, uint16(len(l.channels)))
+		for _, ch := range l.channels {
+			width, height := int(l.right-l.left), int(l.bottom-l.top)
+			if ch.id < -1 && l.mask != nil {
+				width, height = int(l.mask.Width()), int(l.mask.Height())
+			}
+			encoded := d.encodeChannel(ch, width, height)
+			writeBE(records, ch.id)
+			d.writeLength(records, uint64(len(encoded)))
+			channelData.Write(encoded)
+		}
+
+		blendMode := l.blendMode
+		if blendMode == "" {
+			blendMode = "norm"
+		}
+		records.WriteString("8BIM")
+		records.WriteString(blendMode)
+		records.WriteByte(l.opacity)
+		records.WriteByte(0) // clipping
+		records.WriteByte(l.flags)
+		records.WriteByte(0) // filler
+
+		extra := new(bytes.Buffer)
+		if l.mask != nil {
+			writeBE(extra, uint32(20))
+			writeBE(extra, l.mask.Top)
+			writeBE(extra, l.mask.Left)
+			writeBE(extra, l.mask.Bottom)
+			writeBE(extra, l.mask.Right)
+			extra.WriteByte(l.mask.DefaultColor)
+			extra.WriteByte(l.mask.Flags)
+			extra.Write([]byte{0, 0})
+		} else {
+			writeBE(extra, uint32(0))
+		}
+		writeBE(extra, uint32(0)) // blending ranges
+
+		extra.WriteByte(byte(len(l.name)))
+		extra.WriteString(l.name)
+		extra.Write(make([]byte, (4-(len(l.name)+1)%4)%4))
+
+		for _, info := range l.info {
+			extra.WriteString("8BIM")
+			extra.WriteString(info.key)
+			data := append([]byte(nil), info.data...)
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+			if d.big() && bigLayerInfoKeys[info.key] {
+				writeBE(extra, uint64(len(data)))
+			} else {
+				writeBE(extra, uint32(len(data)))
+			}
+			extra.Write(data)
+		}
+
+		writeBE(records, uint32(extra.Len()))
+		records.Write(extra.Bytes())
+	}
+
+	records.Write(channelData.Bytes())
+	for records.Len()%4 != 0 {
+		records.WriteByte(0)
+	}
+	return records.Bytes()
+}
+
+// encodeChannel encodes a layer channel including its compression marker
+func (d *testDoc) encodeChannel(ch testChannel, width, height int) []byte {
+	buf := new(bytes.Buffer)
+	writeBE(buf, ch.compression)
+	switch ch.compression {
+	case 0:
+		buf.Write(ch.data)
+	case 1:
+		rows := encodeRLERows(ch.data, d.rowBytes(width), height)
+		for _, row := range rows {
+			d.writeRLECount(buf, len(row))
+		}
+		for _, row := range rows {
+			buf.Write(row)
+		}
+	case 2, 3:
+		buf.Write(d.encodeZIP(ch.data, d.rowBytes(width), ch.compression == 3))
+	default:
+		buf.Write(ch.data)
+	}
+	return buf.Bytes()
+}
+
+// encodeZIP deflates data, delta encoding each row first for prediction
+func (d *testDoc) encodeZIP(data []byte, rowBytes int, prediction bool) []byte {
+	if prediction {
+		data = append([]byte(nil), data...)
+		for row := 0; row+rowBytes <= len(data); row += rowBytes {
+			predictRow(data[row:row+rowBytes], d.depth)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zlib.NewWriter(buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// predictRow is the inverse of unpredictRow
+func predictRow(row []byte, depth uint16) {
+	switch depth {
+	case 16:
+		for i := len(row) - 2; i >= 2; i -= 2 {
+			prev := binary.BigEndian.Uint16(row[i-2:])
+			cur := binary.BigEndian.Uint16(row[i:])
+			binary.BigEndian.PutUint16(row[i:], cur-prev)
+		}
+	case 32:
+		width := len(row) / 4
+		samples := append([]byte(nil), row...)
+		for x := 0; x < width; x++ {
+			for k := 0; k < 4; k++ {
+				row[k*width+x] = samples[x*4+k]
+			}
+		}
+		for i := len(row) - 1; i >= 1; i-- {
+			row[i] -= row[i-1]
+		}
+	default:
+		for i := len(row) - 1; i >= 1; i-- {
+			row[i] -= row[i-1]
+		}
+	}
+}
+
+func (d *testDoc) writeLength(buf *bytes.Buffer, n uint64) {
+	if d.big() {
+		writeBE(buf, n)
+	} else {
+		writeBE(buf, uint32(n))
+	}
+}
+
+func (d *testDoc) writeRLECount(buf *bytes.Buffer, n int) {
+	if d.big() {
+		writeBE(buf, uint32(n))
+	} else {
+		writeBE(buf, uint16(n))
+	}
+}
+
+// encodeRLERows PackBits-encodes data row by row
+func encodeRLERows(data []byte, rowBytes, height int) [][]byte {
+	rows := make([][]byte, height)
+	for y := 0; y < height; y++ {
+		rows[y] = encodePackBits(data[y*rowBytes : (y+1)*rowBytes])
+	}
+	return rows
+}
+
+func encodePackBits(src []byte) []byte {
+	var out []byte
+	for i := 0; i < len(src); {
+		run := 1
+		for i+run < len(src) && run < 128 && src[i+run] == src[i] {
+			run++
+		}
+		if run > 1 {
+			out = append(out, byte(257-run), src[i])
+			i += run
+			continue
+		}
+
+		start := i
+		for i < len(src) && i-start < 128 && (i+1 >= len(src) || src[i+1] != src[i]) {
+			i++
+		}
+		if i == start {
+			i++
+		}
+		out = append(out, byte(i-start-1))
+		out = append(out, src[start:i]...)
+	}
+	return out
+}
+
+func writeBE(buf *bytes.Buffer, v interface{}) {
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+// samples16 encodes 16-bit samples big endian
+func samples16(values ...uint16) []byte {
+	buf := new(bytes.Buffer)
+	writeBE(buf, values)
+	return buf.Bytes()
+}
+
+// samples32 encodes 32-bit float samples big endian
+func samples32(values ...float32) []byte {
+	buf := new(bytes.Buffer)
+	writeBE(buf, values)
+	return buf.Bytes()
+}
+
+// fill returns n copies of v
+func fill(v byte, n int) []byte {
+	return bytes.Repeat([]byte{v}, n)
+}
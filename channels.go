@@ -0,0 +1,362 @@
+package psd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Resource IDs describing the extra channels of the composite image
+const (
+	resourceAlphaNames        = 1006 // Pascal names of the alpha channels
+	resourceDisplayInfoLegacy = 1007 // DisplayInfo before Photoshop CS3
+	resourceUnicodeAlphaNames = 1045 // Unicode names of the alpha channels
+	resourceAlphaIdentifiers  = 1053 // Identifiers of the alpha channels
+	resourceAlternateSpots    = 1067 // Alternate spot colours
+	resourceDisplayInfo       = 1077 // DisplayInfo of the alpha channels
+)
+
+// Color spaces of a ColorSpec
+const (
+	ColorSpaceRGB       uint16 = 0
+	ColorSpaceHSB       uint16 = 1
+	ColorSpaceCMYK      uint16 = 2
+	ColorSpacePantone   uint16 = 3
+	ColorSpaceFocoltone uint16 = 4
+	ColorSpaceTrumatch  uint16 = 5
+	ColorSpaceToyo      uint16 = 6
+	ColorSpaceLab       uint16 = 7
+	ColorSpaceGrayscale uint16 = 8
+	ColorSpaceHKS       uint16 = 10
+)
+
+// ColorSpec is a colour as stored in image resources: a colour space and
+// four 16-bit components whose meaning depends on the space
+type ColorSpec struct {
+	Space      uint16
+	Components [4]uint16
+}
+
+// NRGBA converts the colour to 8-bit sRGB. It reports false for colour
+// spaces that cannot be converted without a colour book, such as Pantone.
+func (c ColorSpec) NRGBA() (color.NRGBA, bool) {
+	v := c.Components
+	var r, g, b float64
+	switch c.Space {
+	case ColorSpaceRGB:
+		r, g, b = float64(v[0])/65535, float64(v[1])/65535, float64(v[2])/65535
+	case ColorSpaceHSB:
+		r, g, b = hsbToRGB(float64(v[0])/65535, float64(v[1])/65535, float64(v[2])/65535)
+	case ColorSpaceCMYK:
+		// Components are stored inverted: 0 means full ink coverage
+		r, g, b = NaiveCMYKToRGB(1-float64(v[0])/65535, 1-float64(v[1])/65535, 1-float64(v[2])/65535, 1-float64(v[3])/65535)
+	case ColorSpaceLab:
+		// L is 0...10000, a and b are signed -12800...12700
+		r, g, b = labToSRGB(float64(v[0])/100, float64(int16(v[1]))/100, float64(int16(v[2]))/100)
+	case ColorSpaceGrayscale:
+		// 0...10000 ink coverage
+		gray := 1 - float64(v[0])/10000
+		r, g, b = gray, gray, gray
+	default:
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{R: to8(r), G: to8(g), B: to8(b), A: 255}, true
+}
+
+// hsbToRGB converts hue, saturation and brightness in [0, 1] to RGB
+func hsbToRGB(h, s, v float64) (float64, float64, float64) {
+	h = h * 6
+	sector := int(h) % 6
+	f := h - float64(int(h))
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	switch sector {
+	case 0:
+		return v, t, p
+	case 1:
+		return q, v, p
+	case 2:
+		return p, v, t
+	case 3:
+		return p, q, v
+	case 4:
+		return t, p, v
+	default:
+		return v, p, q
+	}
+}
+
+// readColorSpec reads a colour space followed by four components
+func readColorSpec(reader *bytes.Reader) (ColorSpec, error) {
+	var c ColorSpec
+	if err := binary.Read(reader, binary.BigEndian, &c.Space); err != nil {
+		return c, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &c.Components); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// ChannelKind tells how an extra channel is displayed
+type ChannelKind uint8
+
+const (
+	ChannelKindSelected  ChannelKind = 0 // Alpha channel; colour indicates selected areas
+	ChannelKindProtected ChannelKind = 1 // Alpha channel; colour indicates masked areas
+	ChannelKindSpot      ChannelKind = 2 // Spot colour plate
+)
+
+// String returns a readable name for the kind
+func (k ChannelKind) String() string {
+	switch k {
+	case ChannelKindSelected:
+		return "selected"
+	case ChannelKindProtected:
+		return "protected"
+	case ChannelKindSpot:
+		return "spot"
+	default:
+		return fmt.Sprintf("ChannelKind(%d)", uint8(k))
+	}
+}
+
+// DisplayInfo describes how an extra channel is displayed (resource 1077)
+type DisplayInfo struct {
+	Color   ColorSpec
+	Opacity uint16 // 0...100
+	Kind    ChannelKind
+}
+
+// AlternateSpotColor is the colour shown for a spot channel (resource 1067)
+type AlternateSpotColor struct {
+	ChannelID uint32
+	Color     ColorSpec
+}
+
+// ParseAlphaNames parses the Pascal names of the alpha channels (ID 1006)
+func (r *ResourceSection) ParseAlphaNames() ([]string, error) {
+	return parseAlphaNames(r.resourceData(resourceAlphaNames))
+}
+
+func parseAlphaNames(data []byte) ([]string, error) {
+	names := []string{}
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		if i+1+n > len(data) {
+			return nil, fmt.Errorf("alpha name %d: %w", len(names), errTruncatedRead)
+		}
+		names = append(names, string(data[i+1:i+1+n]))
+		i += 1 + n
+	}
+	return names, nil
+}
+
+// ParseUnicodeAlphaNames parses the Unicode names of the alpha channels
+// (ID 1045)
+func (r *ResourceSection) ParseUnicodeAlphaNames() ([]string, error) {
+	return parseUnicodeAlphaNames(r.resourceData(resourceUnicodeAlphaNames))
+}
+
+func parseUnicodeAlphaNames(data []byte) ([]string, error) {
+	names := []string{}
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf("alpha name %d: %w", len(names), errTruncatedRead)
+		}
+		if uint64(length)*2 > uint64(reader.Len()) {
+			return nil, fmt.Errorf("alpha name %d: %w", len(names), errTruncatedRead)
+		}
+		raw := make([]byte, length*2)
+		reader.Read(raw)
+		names = append(names, strings.TrimRight(decodeUnicodeString(raw), "\x00"))
+	}
+	return names, nil
+}
+
+// ParseAlphaIdentifiers parses the identifiers of the alpha channels
+// (ID 1053)
+func (r *ResourceSection) ParseAlphaIdentifiers() ([]uint32, error) {
+	return parseAlphaIdentifiers(r.resourceData(resourceAlphaIdentifiers))
+}
+
+func parseAlphaIdentifiers(data []byte) ([]uint32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid alpha identifiers length: %d", len(data))
+	}
+	ids := make([]uint32, len(data)/4)
+	for i := range ids {
+		ids[i] = binary.BigEndian.Uint32(data[i*4:])
+	}
+	return ids, nil
+}
+
+// ParseAlternateSpotColors parses the alternate spot colours (ID 1067)
+func (r *ResourceSection) ParseAlternateSpotColors() ([]AlternateSpotColor, error) {
+	return parseAlternateSpotColors(r.resourceData(resourceAlternateSpots))
+}
+
+func parseAlternateSpotColors(data []byte) ([]AlternateSpotColor, error) {
+	if len(data) == 0 {
+		return []AlternateSpotColor{}, nil
+	}
+
+	reader := bytes.NewReader(data)
+	var version, count uint16
+	if err := binary.Read(reader, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+
+	// Each entry takes 14 bytes
+	if int(count)*14 > reader.Len() {
+		return nil, fmt.Errorf("invalid alternate spot colour count: %d", count)
+	}
+	colors := make([]AlternateSpotColor, count)
+	for i := range colors {
+		binary.Read(reader, binary.BigEndian, &colors[i].ChannelID)
+		colors[i].Color, _ = readColorSpec(reader)
+	}
+	return colors, nil
+}
+
+// ParseDisplayInfo parses the display information of the alpha channels
+// (ID 1077), falling back to the pre-CS3 resource 1007
+func (r *ResourceSection) ParseDisplayInfo() ([]DisplayInfo, error) {
+	if data := r.resourceData(resourceDisplayInfo); data != nil {
+		return parseDisplayInfo(data)
+	}
+	return parseLegacyDisplayInfo(r.resourceData(resourceDisplayInfoLegacy))
+}
+
+// parseDisplayInfo parses a version followed by 13 bytes per channel
+func parseDisplayInfo(data []byte) ([]DisplayInfo, error) {
+	if len(data) == 0 {
+		return []DisplayInfo{}, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("display info: %w", errTruncatedRead)
+	}
+	if version := binary.BigEndian.Uint32(data); version != 1 {
+		return nil, fmt.Errorf("unsupported display info version: %d", version)
+	}
+	return readDisplayInfo(data[4:], 13), nil
+}
+
+// parseLegacyDisplayInfo parses 14 bytes per channel, the last one padding
+func parseLegacyDisplayInfo(data []byte) ([]DisplayInfo, error) {
+	return readDisplayInfo(data, 14), nil
+}
+
+func readDisplayInfo(data []byte, size int) []DisplayInfo {
+	infos := make([]DisplayInfo, len(data)/size)
+	for i := range infos {
+		reader := bytes.NewReader(data[i*size:])
+		infos[i].Color, _ = readColorSpec(reader)
+		binary.Read(reader, binary.BigEndian, &infos[i].Opacity)
+		kind, _ := reader.ReadByte()
+		infos[i].Kind = ChannelKind(kind)
+	}
+	return infos
+}
+
+// resourceData returns the data of resource id, or nil if it is missing
+func (r *ResourceSection) resourceData(id uint16) []byte {
+	if resource, ok := r.Resources[id]; ok {
+		return resource.Data
+	}
+	return nil
+}
+
+// Channel is an alpha or spot channel of the composite image together with
+// the name and display information Photoshop stores for it
+type Channel struct {
+	Index int    // Index for Image.ExtraChannel
+	ID    uint32 // Alpha identifier, 0 if the document has none
+	Name  string
+
+	// Kind, Color and Opacity come from the DisplayInfo resource. Without
+	// one, channels are alpha channels showing selected areas.
+	Kind    ChannelKind
+	Color   ColorSpec
+	Opacity uint16 // 0...100
+
+	// AlternateColor is the alternate colour of a spot channel, or nil
+	AlternateColor *ColorSpec
+
+	Data []byte // Samples at the document's bit depth
+
+	image *Image
+}
+
+// IsSpot reports whether the channel is a spot colour plate
+func (c *Channel) IsSpot() bool {
+	return c.Kind == ChannelKindSpot
+}
+
+// ToImage returns the channel as an 8-bit grayscale image. Spot channels
+// hold ink coverage inverted, so 0 is full ink.
+func (c *Channel) ToImage() *image.Gray {
+	return c.image.ExtraChannelImage(c.Index)
+}
+
+// Channels returns the alpha and spot channels of the composite image, in
+// document order, with their names and display information. The Unicode
+// names are used when present. Metadata resources that cannot be parsed are
+// ignored.
+func (p *PSD) Channels() ([]*Channel, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	img, err := p.parseImage(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	names, _ := resources.ParseUnicodeAlphaNames()
+	if len(names) == 0 {
+		names, _ = resources.ParseAlphaNames()
+	}
+	ids, _ := resources.ParseAlphaIdentifiers()
+	infos, _ := resources.ParseDisplayInfo()
+	spots, _ := resources.ParseAlternateSpotColors()
+
+	// The resources describe every channel after the colour channels,
+	// starting with the transparency
+	first := 0
+	if img.HasAlpha() {
+		first = 1
+	}
+
+	channels := make([]*Channel, img.ExtraChannels())
+	for i := range channels {
+		ch := &Channel{Index: i, Data: img.ExtraChannel(i), image: img}
+		if j := first + i; j < len(names) {
+			ch.Name = names[j]
+		}
+		if j := first + i; j < len(ids) {
+			ch.ID = ids[j]
+		}
+		if j := first + i; j < len(infos) {
+			ch.Kind = infos[j].Kind
+			ch.Color = infos[j].Color
+			ch.Opacity = infos[j].Opacity
+		}
+		for _, spot := range spots {
+			if ch.ID != 0 && spot.ChannelID == ch.ID {
+				spotColor := spot.Color
+				ch.AlternateColor = &spotColor
+			}
+		}
+		channels[i] = ch
+	}
+	return channels, nil
+}
@@ -0,0 +1,171 @@
+package psd
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unicodeNames(names ...string) []byte {
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		units := []rune(name)
+		writeBE(buf, uint32(len(units)+1))
+		for _, r := range units {
+			writeBE(buf, uint16(r))
+		}
+		writeBE(buf, uint16(0))
+	}
+	return buf.Bytes()
+}
+
+// channelsDoc returns alphaDoc with a second extra channel and the
+// resources describing both
+func channelsDoc() *testDoc {
+	doc := alphaDoc(true)
+	doc.channels = 6
+	doc.composite = append(doc.composite, []byte{0, 255})
+
+	// Each resource starts with the transparency
+	displayInfo := new(bytes.Buffer)
+	writeBE(displayInfo, uint32(1))
+	writeBE(displayInfo, ColorSpec{Space: ColorSpaceRGB, Components: [4]uint16{65535, 0, 0, 0}})
+	writeBE(displayInfo, uint16(100))
+	displayInfo.WriteByte(byte(ChannelKindProtected))
+	writeBE(displayInfo, ColorSpec{Space: ColorSpaceRGB, Components: [4]uint16{65535, 0, 0, 0}})
+	writeBE(displayInfo, uint16(50))
+	displayInfo.WriteByte(byte(ChannelKindProtected))
+	writeBE(displayInfo, ColorSpec{Space: ColorSpaceCMYK, Components: [4]uint16{65535, 0, 0, 65535}})
+	writeBE(displayInfo, uint16(100))
+	displayInfo.WriteByte(byte(ChannelKindSpot))
+
+	spots := new(bytes.Buffer)
+	writeBE(spots, uint16(1))
+	writeBE(spots, uint16(1))
+	writeBE(spots, uint32(21))
+	writeBE(spots, ColorSpec{Space: ColorSpaceLab, Components: [4]uint16{5000, 0, 0, 0}})
+
+	doc.resources = []testResource{
+		{id: 1006, data: []byte{1, 'T', 5, 'A', 'l', 'p', 'h', 'a', 4, 'S', 'p', 'o', 't'}},
+		{id: 1045, data: unicodeNames("Transparency", "Sélection", "PANTONE 185 C")},
+		{id: 1053, data: []byte{0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 21}},
+		{id: 1067, data: spots.Bytes()},
+		{id: 1077, data: displayInfo.Bytes()},
+	}
+	return doc
+}
+
+func TestChannelResources(t *testing.T) {
+	psd, err := NewFromBytes(channelsDoc().build())
+	require.NoError(t, err)
+	resources := psd.Resources()
+
+	names, err := resources.ParseAlphaNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"T", "Alpha", "Spot"}, names)
+
+	names, err = resources.ParseUnicodeAlphaNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Transparency", "Sélection", "PANTONE 185 C"}, names)
+
+	ids, err := resources.ParseAlphaIdentifiers()
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 20, 21}, ids)
+
+	infos, err := resources.ParseDisplayInfo()
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+	assert.Equal(t, DisplayInfo{Color: ColorSpec{Space: ColorSpaceRGB, Components: [4]uint16{65535}}, Opacity: 50, Kind: ChannelKindProtected}, infos[1])
+	assert.Equal(t, ChannelKindSpot, infos[2].Kind)
+
+	spots, err := resources.ParseAlternateSpotColors()
+	require.NoError(t, err)
+	assert.Equal(t, []AlternateSpotColor{{ChannelID: 21, Color: ColorSpec{Space: ColorSpaceLab, Components: [4]uint16{5000}}}}, spots)
+
+	// Truncated resources are reported
+	_, err = parseAlphaNames([]byte{5, 'A'})
+	assert.ErrorIs(t, err, errTruncatedRead)
+	_, err = parseUnicodeAlphaNames([]byte{0, 0, 0, 9, 0, 'A'})
+	assert.ErrorIs(t, err, errTruncatedRead)
+	_, err = parseAlphaIdentifiers([]byte{0, 0, 1})
+	assert.Error(t, err)
+	_, err = parseAlternateSpotColors([]byte{0, 1, 0, 3, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestChannels(t *testing.T) {
+	psd, err := NewFromBytes(channelsDoc().build())
+	require.NoError(t, err)
+
+	channels, err := psd.Channels()
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+
+	alpha, spot := channels[0], channels[1]
+	assert.Equal(t, "Sélection", alpha.Name)
+	assert.Equal(t, uint32(20), alpha.ID)
+	assert.Equal(t, ChannelKindProtected, alpha.Kind)
+	assert.False(t, alpha.IsSpot())
+	assert.Nil(t, alpha.AlternateColor)
+	assert.Equal(t, []byte{10, 20}, alpha.Data)
+
+	assert.Equal(t, "PANTONE 185 C", spot.Name)
+	assert.True(t, spot.IsSpot())
+	assert.Equal(t, uint16(100), spot.Opacity)
+	require.NotNil(t, spot.AlternateColor)
+	assert.Equal(t, ColorSpaceLab, spot.AlternateColor.Space)
+	assert.Equal(t, []byte{0, 255}, spot.ToImage().Pix)
+
+	rgb, ok := spot.Color.NRGBA()
+	assert.True(t, ok)
+	assert.Equal(t, color.NRGBA{255, 0, 0, 255}, rgb)
+}
+
+func TestChannelsWithoutResources(t *testing.T) {
+	doc := alphaDoc(false)
+	doc.resources = []testResource{{id: 1006, data: []byte{1, 'A', 1, 'B'}}}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+
+	// Pascal names are used without Unicode ones, and channels without
+	// display information are alpha channels
+	channels, err := psd.Channels()
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+	assert.Equal(t, "A", channels[0].Name)
+	assert.Equal(t, "B", channels[1].Name)
+	assert.Equal(t, ChannelKindSelected, channels[1].Kind)
+	assert.Zero(t, channels[1].ID)
+
+	// The fixtures only describe their transparency
+	for _, name := range []string{"example.psd", "blendmodes.psd"} {
+		psd, err = New("testdata/" + name)
+		require.NoError(t, err)
+		channels, err = psd.Channels()
+		require.NoError(t, err)
+		assert.Empty(t, channels, name)
+		psd.Close()
+	}
+}
+
+func TestColorSpecNRGBA(t *testing.T) {
+	for _, tc := range []struct {
+		color ColorSpec
+		want  color.NRGBA
+		ok    bool
+	}{
+		{ColorSpec{Space: ColorSpaceRGB, Components: [4]uint16{0, 32896, 65535}}, color.NRGBA{0, 128, 255, 255}, true},
+		{ColorSpec{Space: ColorSpaceHSB, Components: [4]uint16{0, 65535, 65535}}, color.NRGBA{255, 0, 0, 255}, true},
+		{ColorSpec{Space: ColorSpaceCMYK, Components: [4]uint16{65535, 65535, 65535, 0}}, color.NRGBA{0, 0, 0, 255}, true},
+		{ColorSpec{Space: ColorSpaceGrayscale, Components: [4]uint16{10000}}, color.NRGBA{0, 0, 0, 255}, true},
+		{ColorSpec{Space: ColorSpaceLab, Components: [4]uint16{10000}}, color.NRGBA{255, 255, 255, 255}, true},
+		{ColorSpec{Space: ColorSpacePantone}, color.NRGBA{}, false},
+	} {
+		got, ok := tc.color.NRGBA()
+		assert.Equal(t, tc.ok, ok, "space %d", tc.color.Space)
+		assert.Equal(t, tc.want, got, "space %d", tc.color.Space)
+	}
+}
@@ -0,0 +1,81 @@
+package psd
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cmykDoc returns a 2x1 CMYK document. Samples are stored inverted, so the
+// first pixel is pure cyan and the second is 50% black.
+func cmykDoc() *testDoc {
+	return &testDoc{
+		version:  1,
+		channels: 4,
+		width:    2,
+		height:   1,
+		depth:    8,
+		mode:     ColorModeCMYKColor,
+		layers: []testLayer{{
+			name: "Ink", top: 0, left: 0, bottom: 1, right: 2, opacity: 255,
+			channels: []testChannel{
+				{id: -1, compression: 0, data: []byte{255, 64}},
+				{id: 0, compression: 1, data: []byte{0, 255}},
+				{id: 1, compression: 1, data: []byte{255, 255}},
+				{id: 2, compression: 1, data: []byte{255, 255}},
+				{id: 3, compression: 1, data: []byte{255, 127}},
+			},
+		}},
+		composite: [][]byte{
+			{0, 255},
+			{255, 255},
+			{255, 255},
+			{255, 127},
+		},
+		compositeCompression: 1,
+	}
+}
+
+func TestCMYKComposite(t *testing.T) {
+	psd, err := NewFromBytes(cmykDoc().build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.True(t, psd.Header().IsCMYK())
+
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 0, G: 255, B: 255, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 127, G: 127, B: 127, A: 255}, pixels[1])
+}
+
+func TestCMYKLayer(t *testing.T) {
+	psd, err := NewFromBytes(cmykDoc().build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	img, err := psd.Layers()[0].ToImage()
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0, G: 255, B: 255, A: 255}, img.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{R: 127, G: 127, B: 127, A: 64}, img.RGBAAt(1, 0))
+}
+
+func TestCMYKConverterHook(t *testing.T) {
+	psd, err := NewFromBytes(cmykDoc().build())
+	require.NoError(t, err)
+
+	var calls int
+	psd.SetColorOptions(ColorOptions{
+		CMYKConverter: func(c, m, y, k float64) (float64, float64, float64) {
+			calls++
+			return k, k, k
+		},
+	})
+	require.NoError(t, psd.Parse())
+
+	assert.Equal(t, 2, calls)
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 0, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 128, G: 128, B: 128, A: 255}, pixels[1])
+}
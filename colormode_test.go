@@ -0,0 +1,257 @@
+package psd
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrayscaleLayers(t *testing.T) {
+	doc := &testDoc{
+		version:  1,
+		channels: 1,
+		width:    2,
+		height:   1,
+		depth:    8,
+		mode:     ColorModeGrayscale,
+		layers: []testLayer{{
+			name: "Gray", top: 0, left: 0, bottom: 1, right: 2, opacity: 255,
+			channels: []testChannel{
+				{id: -1, compression: 1, data: []byte{255, 100}},
+				{id: 0, compression: 1, data: []byte{40, 200}},
+			},
+		}},
+		composite: [][]byte{{40, 200}},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.True(t, psd.Header().IsGrayscale())
+	assert.Equal(t, color.RGBAModel, psd.Header().ColorModel())
+
+	img, err := psd.Layers()[0].ToImage()
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 40, G: 40, B: 40, A: 255}, img.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{R: 200, G: 200, B: 200, A: 100}, img.RGBAAt(1, 0))
+
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 200, G: 200, B: 200, A: 255}, pixels[1])
+}
+
+func TestLabComposite(t *testing.T) {
+	doc := &testDoc{
+		version:  1,
+		channels: 3,
+		width:    3,
+		height:   1,
+		depth:    8,
+		mode:     ColorModeLabColor,
+		layers: []testLayer{{
+			name: "Lab", top: 0, left: 0, bottom: 1, right: 1, opacity: 255,
+			channels: []testChannel{
+				{id: 0, compression: 0, data: []byte{138}},
+				{id: 1, compression: 0, data: []byte{209}},
+				{id: 2, compression: 0, data: []byte{198}},
+			},
+		}},
+		// White, black and sRGB red (L=54.1, a=81, b=70)
+		composite: [][]byte{
+			{255, 0, 138},
+			{128, 128, 209},
+			{128, 128, 198},
+		},
+		compositeCompression: 1,
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.Equal(t, color.RGBAModel, psd.Header().ColorModel())
+
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 0, A: 255}, pixels[1])
+	assertColorNear(t, color.RGBA{R: 255, G: 0, B: 0, A: 255}, pixels[2], 4)
+
+	img, err := psd.Layers()[0].ToImage()
+	require.NoError(t, err)
+	assertColorNear(t, color.RGBA{R: 255, G: 0, B: 0, A: 255}, img.RGBAAt(0, 0), 4)
+}
+
+func TestMultichannelComposite(t *testing.T) {
+	doc := &testDoc{
+		version:  1,
+		channels: 2,
+		width:    2,
+		height:   1,
+		depth:    8,
+		mode:     ColorModeMultichannel,
+		// Plates are stored inverted: full cyan, then full magenta
+		composite: [][]byte{
+			{0, 255},
+			{255, 0},
+		},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.Equal(t, 2, psd.Header().ColorChannels())
+
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 0, G: 255, B: 255, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 255, G: 0, B: 255, A: 255}, pixels[1])
+}
+
+func TestHeaderColorModel(t *testing.T) {
+	tests := []struct {
+		mode  uint16
+		depth uint16
+		model color.Model
+	}{
+		{ColorModeRGBColor, 8, color.RGBAModel},
+		{ColorModeRGBColor, 16, color.NRGBA64Model},
+		{ColorModeGrayscale, 8, color.RGBAModel},
+		{ColorModeGrayscale, 16, color.NRGBA64Model},
+		{ColorModeCMYKColor, 8, color.RGBAModel},
+		{ColorModeLabColor, 16, color.NRGBA64Model},
+		{ColorModeIndexedColor, 8, color.RGBAModel}, // No colour table
+	}
+
+	for _, tt := range tests {
+		h := &Header{Mode: tt.mode, Depth: tt.depth}
+		assert.Equal(t, tt.model, h.ColorModel(), "mode %d depth %d", tt.mode, tt.depth)
+	}
+}
+
+func assertColorNear(t *testing.T, expected, actual color.RGBA, delta int) {
+	t.Helper()
+	near := func(a, b uint8) bool {
+		d := int(a) - int(b)
+		return d <= delta && d >= -delta
+	}
+	if !near(expected.R, actual.R) || !near(expected.G, actual.G) || !near(expected.B, actual.B) || !near(expected.A, actual.A) {
+		t.Errorf("expected %v, got %v (delta %d)", expected, actual, delta)
+	}
+}
+
+func TestIndexedComposite(t *testing.T) {
+	palette := make([]byte, 768)
+	palette[1], palette[256+1], palette[512+1] = 255, 128, 0 // entry 1: orange
+	palette[2], palette[256+2], palette[512+2] = 0, 0, 255   // entry 2: blue
+
+	doc := &testDoc{
+		version:   1,
+		channels:  1,
+		width:     3,
+		height:    1,
+		depth:     8,
+		mode:      ColorModeIndexedColor,
+		colorData: palette,
+		composite: [][]byte{{1, 2, 0}},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	header := psd.Header()
+	require.Len(t, header.Palette(), 256)
+	assert.Equal(t, color.RGBA{R: 255, G: 128, B: 0, A: 255}, header.Palette()[1])
+	assert.Equal(t, header.Palette(), header.ColorModel())
+
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 255, G: 128, B: 0, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 255, A: 255}, pixels[1])
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 0, A: 255}, pixels[2])
+
+	paletted := psd.Image().ToPaletted()
+	require.NotNil(t, paletted)
+	assert.Equal(t, []uint8{1, 2, 0}, paletted.Pix)
+	assert.Equal(t, color.RGBA{R: 0, G: 0, B: 255, A: 255}, paletted.At(1, 0))
+}
+
+func TestBitmapComposite(t *testing.T) {
+	for _, compression := range []uint16{0, 1} {
+		// 10 pixels per row pad to 2 bytes; set bits are black
+		doc := &testDoc{
+			version:              1,
+			channels:             1,
+			width:                10,
+			height:               2,
+			depth:                1,
+			mode:                 ColorModeBitmap,
+			composite:            [][]byte{{0b10100000, 0b01000000, 0xff, 0x00}},
+			compositeCompression: compression,
+		}
+
+		psd, err := NewFromBytes(doc.build())
+		require.NoError(t, err)
+		require.NoError(t, psd.Parse())
+
+		assert.True(t, psd.Header().IsBitmap())
+		assert.Nil(t, psd.Image().ToPaletted())
+
+		img := psd.Image().ToPNG()
+		black := color.RGBA{A: 255}
+		white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		assert.Equal(t, black, img.RGBAAt(0, 0))
+		assert.Equal(t, white, img.RGBAAt(1, 0))
+		assert.Equal(t, black, img.RGBAAt(2, 0))
+		assert.Equal(t, black, img.RGBAAt(9, 0))
+		assert.Equal(t, white, img.RGBAAt(8, 0))
+		assert.Equal(t, black, img.RGBAAt(7, 1))
+		assert.Equal(t, white, img.RGBAAt(8, 1))
+	}
+}
+
+func TestBitmapExtraChannel(t *testing.T) {
+	doc := &testDoc{
+		version:   1,
+		channels:  2,
+		width:     10,
+		height:    2,
+		depth:     1,
+		mode:      ColorModeBitmap,
+		composite: [][]byte{{0, 0, 0, 0}, {0b10100000, 0b01000000, 0xff, 0x00}},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	img := psd.Image()
+	require.Equal(t, 1, img.ExtraChannels())
+	gray := img.ExtraChannelImage(0)
+	require.NotNil(t, gray)
+	assert.Equal(t, []uint8{0, 255, 0, 255, 255, 255, 255, 255, 255, 0}, gray.Pix[:10])
+	assert.Equal(t, []uint8{0, 0, 0, 0, 0, 0, 0, 0, 255, 255}, gray.Pix[10:])
+}
+
+func TestDuotoneData(t *testing.T) {
+	spec := []byte{0, 1, 2, 3, 4, 5}
+	doc := &testDoc{
+		version:   1,
+		channels:  1,
+		width:     1,
+		height:    1,
+		depth:     8,
+		mode:      ColorModeDuotone,
+		colorData: spec,
+		composite: [][]byte{{90}},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.Equal(t, spec, psd.Header().DuotoneData())
+	assert.Nil(t, psd.Header().Palette())
+	assert.Equal(t, color.RGBA{R: 90, G: 90, B: 90, A: 255}, psd.Image().PixelData()[0])
+}
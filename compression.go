@@ -0,0 +1,71 @@
+package psd
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Compression methods for layer channel and image data
+const (
+	CompressionRaw           = 0
+	CompressionRLE           = 1
+	CompressionZIP           = 2
+	CompressionZIPPrediction = 3
+)
+
+// decompressZIP inflates zlib compressed channel data into exactly size
+// bytes. With prediction set, the rows are then delta decoded.
+func decompressZIP(data []byte, size, rowBytes int, depth uint16, prediction bool) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zlib stream: %w", err)
+	}
+	defer zr.Close()
+
+	result := make([]byte, size)
+	if _, err := io.ReadFull(zr, result); err != nil {
+		return nil, fmt.Errorf("failed to inflate zlib stream: %w", err)
+	}
+
+	if prediction && rowBytes > 0 {
+		for row := 0; row+rowBytes <= len(result); row += rowBytes {
+			unpredictRow(result[row:row+rowBytes], depth)
+		}
+	}
+
+	return result, nil
+}
+
+// unpredictRow reverses Photoshop's per-row delta encoding in place. 16-bit
+// rows hold deltas between consecutive samples. 32-bit rows are delta coded
+// byte by byte and store the samples' bytes as planes (all first bytes, then
+// all second bytes, ...), which are interleaved back into big endian floats.
+func unpredictRow(row []byte, depth uint16) {
+	switch depth {
+	case 16:
+		for i := 2; i+1 < len(row); i += 2 {
+			prev := binary.BigEndian.Uint16(row[i-2:])
+			cur := binary.BigEndian.Uint16(row[i:])
+			binary.BigEndian.PutUint16(row[i:], prev+cur)
+		}
+	case 32:
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+		width := len(row) / 4
+		planes := make([]byte, len(row))
+		copy(planes, row)
+		for x := 0; x < width; x++ {
+			for k := 0; k < 4; k++ {
+				row[x*4+k] = planes[k*width+x]
+			}
+		}
+	default:
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+	}
+}
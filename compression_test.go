@@ -0,0 +1,92 @@
+package psd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func zipDoc(depth uint16, compression uint16, red, green, blue []byte) *testDoc {
+	return &testDoc{
+		version:  1,
+		channels: 3,
+		width:    3,
+		height:   2,
+		depth:    depth,
+		mode:     ColorModeRGBColor,
+		layers: []testLayer{{
+			name: "Zipped", top: 0, left: 0, bottom: 2, right: 3, opacity: 255,
+			channels: []testChannel{
+				{id: 0, compression: compression, data: red},
+				{id: 1, compression: compression, data: green},
+				{id: 2, compression: compression, data: blue},
+			},
+		}},
+		composite:            [][]byte{red, green, blue},
+		compositeCompression: compression,
+	}
+}
+
+func TestZIPCompression(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth uint16
+		red   []byte
+		green []byte
+		blue  []byte
+	}{
+		{
+			name:  "8-bit",
+			depth: 8,
+			red:   []byte{1, 2, 250, 7, 7, 0},
+			green: []byte{0, 128, 255, 3, 200, 1},
+			blue:  fill(9, 6),
+		},
+		{
+			name:  "16-bit",
+			depth: 16,
+			red:   samples16(1, 65535, 2, 30000, 0, 12),
+			green: samples16(0x8000, 0x0001, 0xfffe, 5, 5, 5),
+			blue:  samples16(0, 0, 0, 65535, 65535, 65535),
+		},
+		{
+			name:  "32-bit",
+			depth: 32,
+			red:   samples32(0, 0.25, 1, 2.5, -1, 0.001),
+			green: samples32(1, 1, 1, 0, 0, 0),
+			blue:  samples32(0.5, 0.125, 0.75, 4, 8, 16),
+		},
+	}
+
+	for _, tt := range tests {
+		for _, compression := range []uint16{CompressionZIP, CompressionZIPPrediction} {
+			doc := zipDoc(tt.depth, compression, tt.red, tt.green, tt.blue)
+
+			psd, err := NewFromBytes(doc.build())
+			require.NoError(t, err)
+			require.NoError(t, psd.Parse(), "%s compression %d", tt.name, compression)
+
+			layer := psd.Layers()[0]
+			assert.Equal(t, tt.red, layer.ChannelData[0], "%s compression %d", tt.name, compression)
+			assert.Equal(t, tt.green, layer.ChannelData[1], "%s compression %d", tt.name, compression)
+			assert.Equal(t, tt.blue, layer.ChannelData[2], "%s compression %d", tt.name, compression)
+
+			image := psd.Image()
+			assert.Equal(t, [][]byte{tt.red, tt.green, tt.blue}, image.channelData, "%s compression %d", tt.name, compression)
+		}
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	doc := zipDoc(8, 7, fill(1, 6), fill(2, 6), fill(3, 6))
+	doc.compositeCompression = 0
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+
+	err = psd.Parse()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	assert.Contains(t, err.Error(), "method 7")
+}
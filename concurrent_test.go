@@ -0,0 +1,200 @@
+package psd
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meant to be run with -race
+
+// runConcurrently calls fn from n goroutines at once
+func runConcurrently(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestConcurrentLazyAccessors(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.psd")
+	require.NoError(t, err)
+
+	for name, open := range map[string]func() (*PSD, error){
+		"file":  func() (*PSD, error) { return New("testdata/example.psd") },
+		"bytes": func() (*PSD, error) { return NewFromBytes(data) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Nothing is parsed up front, so every section is parsed by
+			// whichever goroutine gets there first
+			psd, err := open()
+			require.NoError(t, err)
+			defer psd.Close()
+
+			headers := make([]*Header, 8)
+			layers := make([][]*Layer, 8)
+			images := make([]*Image, 8)
+			runConcurrently(8, func(i int) {
+				switch i % 4 {
+				case 0:
+					psd.Resources()
+					psd.Guides()
+				case 1:
+					psd.Tree()
+				case 2:
+					psd.Image().PixelData()
+				}
+				headers[i] = psd.Header()
+				layers[i] = psd.Layers()
+				images[i] = psd.Image()
+			})
+
+			for i := range headers {
+				assert.Same(t, headers[0], headers[i])
+				assert.Equal(t, layers[0], layers[i])
+				assert.Same(t, images[0], images[i])
+			}
+			assert.Len(t, layers[0], 15)
+		})
+	}
+}
+
+func TestConcurrentRender(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	nodes := append([]*Node{psd.Tree()}, psd.Tree().Children...)
+	want := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		img, err := NewRenderer(node).Render()
+		require.NoError(t, err)
+		want[i] = img.Pix
+	}
+
+	// Render every node twice at once, releasing channels in half the
+	// renders while the others still use them
+	got := make([][]byte, 2*len(nodes))
+	runConcurrently(len(got), func(i int) {
+		node := nodes[i%len(nodes)]
+		opts := RendererOptions{ReleaseChannels: i%2 == 0}
+		img, err := NewRendererWithOptions(node, opts).Render()
+		if assert.NoError(t, err) {
+			got[i] = img.Pix
+		}
+	})
+
+	for i := range got {
+		assert.Equal(t, want[i%len(nodes)], got[i], "node %d", i%len(nodes))
+	}
+}
+
+func TestConcurrentLayerChannels(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	var layer *Layer
+	for _, l := range psd.Layers() {
+		if l.Width() > 0 && l.Height() > 0 && !l.IsFolder() {
+			layer = l
+			break
+		}
+	}
+	require.NotNil(t, layer)
+	want, err := layer.ToImage()
+	require.NoError(t, err)
+	require.NotNil(t, want)
+
+	runConcurrently(16, func(i int) {
+		switch i % 4 {
+		case 0:
+			img, err := layer.ToImage()
+			if assert.NoError(t, err) {
+				assert.Equal(t, want.Pix, img.Pix)
+			}
+		case 1:
+			data, err := layer.Channel(0)
+			if assert.NoError(t, err) {
+				assert.NotEmpty(t, data)
+			}
+		case 2:
+			layer.ReleaseChannels()
+		case 3:
+			if channels := layer.DecodedChannels(); channels != nil {
+				assert.NotEmpty(t, channels[0])
+			}
+		}
+	})
+
+	layer.ReleaseChannels()
+	assert.Nil(t, layer.DecodedChannels())
+	require.NoError(t, layer.LoadChannels())
+	assert.NotEmpty(t, layer.DecodedChannels()[0])
+}
+
+func TestConcurrentWarnings(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[0].channels[1].compression = 9
+	doc.layers[1].channels[2].compression = 9
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true, LazyChannels: true}))
+
+	layers := psd.Layers()
+	runConcurrently(8, func(i int) {
+		layers[i%2].LoadChannels()
+		psd.Warnings()
+	})
+
+	// Each layer is decoded once, recording one warning
+	assert.Len(t, psd.Warnings(), 2)
+}
+
+// TestChannelDataDeprecated checks that the deprecation notice is the doc
+// comment of the ChannelData field, where godoc, gopls and staticcheck
+// look for it
+func TestChannelDataDeprecated(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "layer.go", nil, parser.ParseComments)
+	require.NoError(t, err)
+
+	deprecated := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != "Layer" {
+			return true
+		}
+		for _, field := range spec.Type.(*ast.StructType).Fields.List {
+			for _, name := range field.Names {
+				deprecated[name.Name] = field.Doc != nil &&
+					strings.Contains("\n"+field.Doc.Text(), "\nDeprecated: ")
+			}
+		}
+		return false
+	})
+
+	assert.True(t, deprecated["ChannelData"])
+	for name, ok := range deprecated {
+		if name != "ChannelData" {
+			assert.False(t, ok, "field %s", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package psd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countdownContext is cancelled after its Err method has been called n
+// times, so cancellation lands at each check in turn
+type countdownContext struct {
+	context.Context
+	n atomic.Int64
+}
+
+func newCountdownContext(n int64) *countdownContext {
+	ctx := &countdownContext{Context: context.Background()}
+	ctx.n.Store(n)
+	return ctx
+}
+
+func (c *countdownContext) Err() error {
+	if c.n.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestParseContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	assert.Equal(t, context.Canceled, psd.ParseContext(ctx))
+	assert.False(t, psd.Parsed())
+
+	// The document is still usable
+	require.NoError(t, psd.Parse())
+	assert.Len(t, psd.Layers(), 15)
+}
+
+func TestParseContextConsistent(t *testing.T) {
+	want, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer want.Close()
+	require.NoError(t, want.Parse())
+
+	cancelled := 0
+	for n := int64(0); ; n = n*2 + 1 {
+		psd, err := New("testdata/example.psd")
+		require.NoError(t, err)
+
+		err = psd.ParseWithOptionsContext(newCountdownContext(n), ParseOptions{Concurrency: 2})
+		if err == nil {
+			psd.Close()
+			break
+		}
+		require.ErrorIs(t, err, context.Canceled, "after %d checks", n)
+		cancelled++
+
+		// Only completed sections are kept; the rest parse on access
+		require.NoError(t, psd.Parse())
+		layers := psd.Layers()
+		require.Len(t, layers, len(want.Layers()))
+		for i, layer := range layers {
+			assert.Equal(t, want.Layers()[i].ChannelData, layer.ChannelData, "layer %d after %d checks", i, n)
+		}
+		assert.Equal(t, want.Image().PixelData(), psd.Image().PixelData())
+		assert.Equal(t, want.state.budget.used.Load(), psd.state.budget.used.Load(), "after %d checks", n)
+		psd.Close()
+	}
+	assert.Greater(t, cancelled, 5)
+}
+
+func TestParseContextLenient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	psd, err := NewFromBytes(errorDoc().build())
+	require.NoError(t, err)
+
+	err = psd.ParseWithOptionsContext(ctx, ParseOptions{Lenient: true})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, psd.Warnings())
+}
+
+func TestRenderContext(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	renderer := NewRenderer(psd.Tree())
+	for _, n := range []int64{0, 1, 20, 200} {
+		_, err := renderer.RenderContext(newCountdownContext(n))
+		assert.Equal(t, context.Canceled, err, "after %d checks", n)
+	}
+
+	want, err := NewRenderer(psd.Tree()).Render()
+	require.NoError(t, err)
+	got, err := renderer.RenderContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, want.Pix, got.Pix)
+}
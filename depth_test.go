@@ -0,0 +1,102 @@
+package psd
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse16Bit(t *testing.T) {
+	doc := &testDoc{
+		version:  1,
+		channels: 3,
+		width:    2,
+		height:   1,
+		depth:    16,
+		mode:     ColorModeRGBColor,
+		layers: []testLayer{{
+			name: "Deep", top: 0, left: 0, bottom: 1, right: 2, opacity: 255,
+			channels: []testChannel{
+				{id: -1, compression: 1, data: samples16(65535, 32768)},
+				{id: 0, compression: 1, data: samples16(65535, 0)},
+				{id: 1, compression: 0, data: samples16(0x1234, 0x1234)},
+				{id: 2, compression: 1, data: samples16(0, 65535)},
+			},
+		}},
+		layersKey: "Lr16",
+		composite: [][]byte{
+			samples16(0x0101, 0xffff),
+			samples16(0x8000, 0x1234),
+			samples16(0, 0x7f7f),
+		},
+		compositeCompression: 1,
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	img := psd.Image()
+	deep := img.ToNRGBA64()
+	assert.Equal(t, color.NRGBA64{R: 0x0101, G: 0x8000, B: 0, A: 0xffff}, deep.NRGBA64At(0, 0))
+	assert.Equal(t, color.NRGBA64{R: 0xffff, G: 0x1234, B: 0x7f7f, A: 0xffff}, deep.NRGBA64At(1, 0))
+
+	// 8-bit down-conversion
+	assert.Equal(t, color.RGBA{R: 1, G: 128, B: 0, A: 255}, img.PixelData()[0])
+	assert.Equal(t, color.RGBA{R: 255, G: 18, B: 127, A: 255}, img.PixelData()[1])
+
+	layers := psd.Layers()
+	require.Len(t, layers, 1)
+
+	layerImg, err := layers[0].ToImage64()
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA64{R: 65535, G: 0x1234, B: 0, A: 65535}, layerImg.NRGBA64At(0, 0))
+	assert.Equal(t, color.NRGBA64{R: 0, G: 0x1234, B: 65535, A: 32768}, layerImg.NRGBA64At(1, 0))
+
+	layer8, err := layers[0].ToImage()
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0, G: 18, B: 255, A: 128}, layer8.RGBAAt(1, 0))
+}
+
+func TestParse32Bit(t *testing.T) {
+	doc := &testDoc{
+		version:  1,
+		channels: 3,
+		width:    3,
+		height:   1,
+		depth:    32,
+		mode:     ColorModeRGBColor,
+		composite: [][]byte{
+			samples32(0, 1, 4),
+			samples32(0.5, 1, 4),
+			samples32(0.2140, 1, -1),
+		},
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	// Default tone mapping clamps and applies the sRGB curve
+	pixels := psd.Image().PixelData()
+	assert.Equal(t, color.RGBA{R: 0, G: 188, B: 127, A: 255}, pixels[0])
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, pixels[1])
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 0, A: 255}, pixels[2])
+
+	// A custom tone mapper is used for later conversions
+	psd.SetColorOptions(ColorOptions{ToneMapper: ToneMapReinhard})
+	deep := psd.Image().ToNRGBA64()
+	r, _, _, _ := deep.NRGBA64At(2, 0).RGBA()
+	assert.Less(t, r, uint32(0xffff))
+	assert.Greater(t, r, uint32(0xe000))
+}
+
+func TestToneMappers(t *testing.T) {
+	assert.Equal(t, float32(0), ToneMapClamp(-1))
+	assert.Equal(t, float32(1), ToneMapClamp(2))
+	assert.InDelta(t, 0.7354, ToneMapClamp(0.5), 0.001)
+	assert.InDelta(t, ToneMapClamp(0.5), ToneMapReinhard(1), 0.0001)
+	assert.InDelta(t, ToneMapClamp(0.5), ToneMapExposure(-1)(1), 0.0001)
+}
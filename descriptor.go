@@ -16,18 +16,54 @@ type Descriptor struct {
 
 // DescriptorParser parses descriptor data from PSD files
 type DescriptorParser struct {
-	reader *bytes.Reader
+	reader   *bytes.Reader
+	maxDepth int
+	depth    int
 }
 
-// NewDescriptorParser creates a new descriptor parser
+// NewDescriptorParser creates a new descriptor parser using DefaultLimits
 func NewDescriptorParser(data []byte) *DescriptorParser {
+	return NewDescriptorParserWithLimits(data, DefaultLimits)
+}
+
+// NewDescriptorParserWithLimits creates a new descriptor parser that
+// rejects descriptors nested deeper than limits.MaxDescriptorDepth
+func NewDescriptorParserWithLimits(data []byte, limits Limits) *DescriptorParser {
 	return &DescriptorParser{
-		reader: bytes.NewReader(data),
+		reader:   bytes.NewReader(data),
+		maxDepth: limits.withDefaults().MaxDescriptorDepth,
+	}
+}
+
+// enter descends into a nested descriptor or list
+func (d *DescriptorParser) enter() error {
+	d.depth++
+	if d.maxDepth > 0 && d.depth > d.maxDepth {
+		return fmt.Errorf("%w: descriptor nesting exceeds %d", ErrLimitExceeded, d.maxDepth)
+	}
+	return nil
+}
+
+func (d *DescriptorParser) leave() {
+	d.depth--
+}
+
+// checkRemaining fails if fewer than n bytes remain, before a buffer of
+// that size is allocated
+func (d *DescriptorParser) checkRemaining(n uint64) error {
+	if n > uint64(d.reader.Len()) {
+		return errTruncatedRead
 	}
+	return nil
 }
 
 // Parse parses a descriptor and returns the result as a map
 func (d *DescriptorParser) Parse() (map[string]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
 	result := make(map[string]interface{})
 
 	// Parse class
@@ -93,6 +129,9 @@ func (d *DescriptorParser) parseID() (string, error) {
 	}
 
 	// Variable length string
+	if err := d.checkRemaining(uint64(length)); err != nil {
+		return "", err
+	}
 	buf := make([]byte, length)
 	if _, err := io.ReadFull(d.reader, buf); err != nil {
 		return "", err
@@ -224,6 +263,9 @@ func (d *DescriptorParser) parseAlias() ([]byte, error) {
 		return nil, err
 	}
 
+	if err := d.checkRemaining(uint64(length)); err != nil {
+		return nil, err
+	}
 	data := make([]byte, length)
 	if _, err := io.ReadFull(d.reader, data); err != nil {
 		return nil, err
@@ -239,6 +281,15 @@ func (d *DescriptorParser) parseList() ([]interface{}, error) {
 		return nil, err
 	}
 
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	// Every item starts with a 4-byte type
+	if err := d.checkRemaining(uint64(count) * 4); err != nil {
+		return nil, err
+	}
 	items := make([]interface{}, count)
 	for i := uint32(0); i < count; i++ {
 		value, err := d.parseItem("")
@@ -265,6 +316,9 @@ func (d *DescriptorParser) parseRawData() ([]byte, error) {
 		return nil, err
 	}
 
+	if err := d.checkRemaining(uint64(length)); err != nil {
+		return nil, err
+	}
 	data := make([]byte, length)
 	if _, err := io.ReadFull(d.reader, data); err != nil {
 		return nil, err
@@ -280,6 +334,9 @@ func (d *DescriptorParser) parseReference() ([]map[string]interface{}, error) {
 		return nil, err
 	}
 
+	if err := d.checkRemaining(uint64(numItems) * 4); err != nil {
+		return nil, err
+	}
 	items := make([]map[string]interface{}, numItems)
 	for i := uint32(0); i < numItems; i++ {
 		typeBytes := make([]byte, 4)
@@ -442,7 +499,10 @@ func (d *DescriptorParser) readUnicodeString() (string, error) {
 	}
 
 	// Read UTF-16 big-endian data
-	data := make([]byte, length*2)
+	if err := d.checkRemaining(uint64(length) * 2); err != nil {
+		return "", err
+	}
+	data := make([]byte, uint64(length)*2)
 	if _, err := io.ReadFull(d.reader, data); err != nil {
 		return "", err
 	}
@@ -0,0 +1,99 @@
+package psd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Sentinel errors returned (wrapped) by parsing. Test for them with
+// errors.Is.
+var (
+	// ErrNotPSD is returned when the file does not start with the 8BPS
+	// signature
+	ErrNotPSD = errors.New("psd: not a PSD or PSB file")
+
+	// ErrUnsupportedVersion is returned for versions other than 1 (PSD)
+	// and 2 (PSB)
+	ErrUnsupportedVersion = errors.New("psd: unsupported version")
+
+	// ErrTruncated is returned when the file ends before a section, layer
+	// or block it declares
+	ErrTruncated = errors.New("psd: truncated file")
+
+	// ErrUnsupportedCompression is returned for channel or image data using
+	// an unknown compression method
+	ErrUnsupportedCompression = errors.New("psd: unsupported compression")
+
+	// ErrResourceNotFound is returned by ResourceSection.Decode for image
+	// resources the document does not have
+	ErrResourceNotFound = errors.New("psd: image resource not found")
+)
+
+// errTruncatedRead is returned by File.Read when the file ends early
+var errTruncatedRead = fmt.Errorf("%w: %w", ErrTruncated, io.ErrUnexpectedEOF)
+
+// Sections reported in ParseError
+const (
+	SectionHeader    = "header"
+	SectionResources = "resources"
+	SectionLayers    = "layer and mask"
+	SectionImage     = "image data"
+)
+
+// ParseError describes where in the file parsing failed. Retrieve it with
+// errors.As; the underlying cause is available through errors.Unwrap and
+// errors.Is.
+type ParseError struct {
+	// Section is one of SectionHeader, SectionResources, SectionLayers or
+	// SectionImage
+	Section string
+
+	// Layer is the index of the failing layer record in file order
+	// (bottom to top), or -1 when the error is not specific to a layer
+	Layer int
+
+	// Key is the additional layer information key or the image resource ID
+	// being parsed, if any
+	Key string
+
+	// Offset is the file offset of the failing section, layer record,
+	// channel, resource or block
+	Offset int64
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to parse %s section at offset %d", e.Section, e.Offset)
+
+	var details []string
+	if e.Layer >= 0 {
+		details = append(details, fmt.Sprintf("layer %d", e.Layer))
+	}
+	if e.Key != "" {
+		details = append(details, fmt.Sprintf("key %q", e.Key))
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(details, ", "))
+	}
+
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError attributes err to a location in the file. If err already
+// carries a *ParseError, that innermost one is returned instead.
+func newParseError(section string, layer int, key string, offset int64, err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	return &ParseError{Section: section, Layer: layer, Key: key, Offset: offset, Err: err}
+}
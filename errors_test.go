@@ -0,0 +1,315 @@
+package psd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func errorDoc() *testDoc {
+	layer := func(name string) testLayer {
+		return testLayer{
+			name: name, top: 0, left: 0, bottom: 2, right: 2, opacity: 255,
+			channels: []testChannel{
+				{id: 0, data: fill(1, 4)},
+				{id: 1, data: fill(2, 4)},
+				{id: 2, data: fill(3, 4)},
+			},
+		}
+	}
+	return &testDoc{
+		version:   1,
+		channels:  3,
+		width:     2,
+		height:    2,
+		depth:     8,
+		mode:      ColorModeRGBColor,
+		resources: []testResource{{id: 1037, data: []byte{0, 0, 0, 30}}},
+		layers:    []testLayer{layer("Bottom"), layer("Top")},
+		composite: [][]byte{fill(1, 4), fill(2, 4), fill(3, 4)},
+	}
+}
+
+func parseErr(t *testing.T, data []byte) (error, *ParseError) {
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+
+	err = psd.Parse()
+	require.Error(t, err)
+
+	var pe *ParseError
+	require.True(t, errors.As(err, &pe), "%v is not a *ParseError", err)
+	return err, pe
+}
+
+func TestErrNotPSD(t *testing.T) {
+	err, pe := parseErr(t, []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	assert.ErrorIs(t, err, ErrNotPSD)
+	assert.Equal(t, SectionHeader, pe.Section)
+	assert.Equal(t, -1, pe.Layer)
+	assert.Equal(t, int64(0), pe.Offset)
+}
+
+func TestErrUnsupportedVersion(t *testing.T) {
+	data := errorDoc().build()
+	binary.BigEndian.PutUint16(data[4:], 3)
+
+	err, pe := parseErr(t, data)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	assert.Equal(t, SectionHeader, pe.Section)
+}
+
+func TestErrTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.psd")
+	require.NoError(t, err)
+
+	err, pe := parseErr(t, data[:20])
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, SectionHeader, pe.Section)
+
+	// Cut inside the channel data of the last layer record
+	full := errorDoc().build()
+	psd, err := NewFromBytes(full)
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+	cut := int(psd.imagePos) - 8
+
+	err, pe = parseErr(t, full[:cut])
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.Equal(t, SectionLayers, pe.Section)
+	assert.Equal(t, 1, pe.Layer)
+}
+
+func TestErrUnsupportedCompressionLocation(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[1].channels[2].compression = 9
+
+	err, pe := parseErr(t, doc.build())
+	assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	assert.Equal(t, SectionLayers, pe.Section)
+	assert.Equal(t, 1, pe.Layer)
+	assert.Equal(t, pe.Offset, psdChannelOffset(t, doc, 1, 2))
+	assert.Contains(t, err.Error(), "(layer 1)")
+}
+
+func TestParseErrorBlendModeSignature(t *testing.T) {
+	data := errorDoc().build()
+
+	// Corrupt every blend mode signature
+	for i := 0; i+4 <= len(data); i++ {
+		if string(data[i:i+4]) == "8BIM" && i+8 <= len(data) && string(data[i+4:i+8]) == "norm" {
+			copy(data[i:], "XXXX")
+		}
+	}
+
+	err, pe := parseErr(t, data)
+	assert.Equal(t, SectionLayers, pe.Section)
+	assert.Equal(t, 0, pe.Layer)
+	assert.Contains(t, pe.Err.Error(), "invalid blend mode signature")
+	assert.Contains(t, err.Error(), "(layer 0)")
+}
+
+func TestParseErrorResourceKey(t *testing.T) {
+	data := errorDoc().build()
+
+	// Resources start after the 26-byte header and 4-byte colour data
+	// length; claim more data than the first resource holds
+	const resourcePos = 26 + 4 + 4
+	binary.BigEndian.PutUint32(data[resourcePos+8:], 0x1000)
+
+	err, pe := parseErr(t, data)
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.Equal(t, SectionResources, pe.Section)
+	assert.Equal(t, "1037", pe.Key)
+	assert.Equal(t, int64(resourcePos), pe.Offset)
+}
+
+// psdChannelOffset returns the offset of a channel's compression marker
+func psdChannelOffset(t *testing.T, doc *testDoc, layer, channel int) int64 {
+	valid := *doc
+	valid.layers = append([]testLayer(nil), doc.layers...)
+	valid.layers[layer].channels = append([]testChannel(nil), doc.layers[layer].channels...)
+	valid.layers[layer].channels[channel].compression = 0
+
+	psd, err := NewFromBytes(valid.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	// Layers are returned top to bottom
+	l := psd.Layers()[len(doc.layers)-1-layer]
+	return l.channelOffsets[channel]
+}
+
+func parseLenient(t *testing.T, data []byte) *PSD {
+	strict, err := NewFromBytes(data)
+	require.NoError(t, err)
+	require.Error(t, strict.Parse(), "strict parsing should fail")
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true}))
+	return psd
+}
+
+func TestLenientSkipsBrokenRecord(t *testing.T) {
+	data := errorDoc().build()
+
+	// Corrupt the blend mode signature of the bottom layer only
+	for i := 0; i+8 <= len(data); i++ {
+		if string(data[i:i+8]) == "8BIMnorm" {
+			copy(data[i:], "XXXX")
+			break
+		}
+	}
+
+	psd := parseLenient(t, data)
+
+	layers := psd.Layers()
+	require.Len(t, layers, 1)
+	assert.Equal(t, "Top", layers[0].Name)
+	assert.Equal(t, fill(3, 4), layers[0].ChannelData[2])
+	img, err := layers[0].ToImage()
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{1, 2, 3, 255}, img.Pix[:4])
+
+	require.Len(t, psd.Warnings(), 1)
+	warning := psd.Warnings()[0]
+	assert.Equal(t, SectionLayers, warning.Section)
+	assert.Equal(t, 0, warning.Layer)
+	assert.Contains(t, warning.Err.Error(), "invalid blend mode signature")
+
+	// The composite after the layers is still aligned
+	assert.Equal(t, uint8(1), psd.Image().PixelData()[0].R)
+}
+
+func TestLenientUnlocatableRecord(t *testing.T) {
+	// The top layer's size fails before its record length is read, so no
+	// channel data can be located
+	doc := errorDoc()
+	doc.layers[1].right = 400001
+	psd := parseLenient(t, doc.build())
+
+	assert.Empty(t, psd.Layers())
+	require.Len(t, psd.Warnings(), 1)
+	assert.ErrorIs(t, psd.Warnings()[0], ErrLimitExceeded)
+	assert.Equal(t, 1, psd.Warnings()[0].Layer)
+
+	// The composite after the layers survives
+	assert.Equal(t, color.RGBA{R: 1, G: 2, B: 3, A: 255}, psd.Image().PixelData()[0])
+}
+
+func TestLenientResource(t *testing.T) {
+	// The middle resource exceeds the limits but its length is known, so
+	// the resources after it are kept
+	doc := errorDoc()
+	doc.resources = []testResource{
+		{id: 1037, data: []byte{0, 0, 0, 30}},
+		{id: 1049, data: fill(7, 33)},
+		{id: 1044, data: []byte{0, 0, 0, 9}},
+	}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true, Limits: Limits{MaxResourceSize: 8}}))
+
+	resources := psd.Resources().Resources
+	assert.Contains(t, resources, uint16(1037))
+	assert.NotContains(t, resources, uint16(1049))
+	assert.Equal(t, []byte{0, 0, 0, 9}, resources[1044].Data)
+
+	require.Len(t, psd.Warnings(), 1)
+	assert.Equal(t, "1049", psd.Warnings()[0].Key)
+	assert.ErrorIs(t, psd.Warnings()[0], ErrLimitExceeded)
+
+	// The layers after the resources are still aligned
+	require.Len(t, psd.Layers(), 2)
+	assert.Equal(t, fill(1, 4), psd.Layers()[0].ChannelData[0])
+}
+
+func TestLenientLayerInfoSignature(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[0].info = []testInfo{
+		{key: "lyid", data: []byte{0, 0, 0, 7}},
+		{key: "lyid", data: []byte{0, 0, 0, 8}},
+	}
+	data := doc.build()
+
+	// Corrupt the signature of the second block
+	first := bytes.Index(data, []byte("8BIMlyid"))
+	second := first + 8 + 4 + 4
+	require.Equal(t, "8BIMlyid", string(data[second:second+8]))
+	copy(data[second:], "ABCD")
+
+	// Strict parsing skips the remaining blocks without failing, as
+	// lenient parsing does, but records no warning
+	strict, err := NewFromBytes(data)
+	require.NoError(t, err)
+	require.NoError(t, strict.Parse())
+	assert.Equal(t, []byte{0, 0, 0, 7}, strict.Layers()[1].LayerInfo["lyid"])
+	assert.Empty(t, strict.Warnings())
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true}))
+
+	layers := psd.Layers()
+	require.Len(t, layers, 2)
+	assert.Equal(t, []byte{0, 0, 0, 7}, layers[1].LayerInfo["lyid"])
+	assert.Equal(t, "Top", layers[0].Name)
+	assert.Equal(t, fill(1, 4), layers[0].ChannelData[0])
+
+	require.Len(t, psd.Warnings(), 1)
+	assert.Equal(t, 0, psd.Warnings()[0].Layer)
+	assert.Equal(t, int64(second), psd.Warnings()[0].Offset)
+}
+
+func TestLenientChannelAndImage(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[1].channels[1].compression = 9
+	doc.compositeCompression = 9
+
+	psd := parseLenient(t, doc.build())
+
+	layers := psd.Layers()
+	require.Len(t, layers, 2)
+	assert.Equal(t, fill(1, 4), layers[0].ChannelData[0])
+	assert.NotContains(t, layers[0].ChannelData, int16(1))
+
+	warnings := psd.Warnings()
+	require.Len(t, warnings, 2)
+	assert.ErrorIs(t, warnings[0], ErrUnsupportedCompression)
+	assert.Equal(t, 1, warnings[0].Layer)
+	assert.ErrorIs(t, warnings[1], ErrUnsupportedCompression)
+	assert.Equal(t, SectionImage, warnings[1].Section)
+
+	// The composite that failed to decode is left empty
+	assert.Empty(t, psd.Image().PixelData())
+	assert.Equal(t, uint32(0), psd.Image().Width())
+}
+
+func TestLenientTruncated(t *testing.T) {
+	full := errorDoc().build()
+	psd, err := NewFromBytes(full)
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	// Cut inside the last channel of the top layer
+	psd = parseLenient(t, full[:psd.imagePos-8])
+
+	layers := psd.Layers()
+	require.Len(t, layers, 2)
+	assert.Equal(t, fill(1, 4), layers[1].ChannelData[0])
+	assert.NotContains(t, layers[0].ChannelData, int16(2))
+
+	require.NotEmpty(t, psd.Warnings())
+	for _, warning := range psd.Warnings() {
+		assert.ErrorIs(t, warning, ErrTruncated)
+	}
+}
@@ -0,0 +1,385 @@
+package psd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Resource IDs of the EXIF data
+const (
+	resourceEXIF1 = 1058
+	resourceEXIF3 = 1059
+)
+
+// ErrInvalidEXIF is returned for EXIF data that is not a valid TIFF structure
+var ErrInvalidEXIF = errors.New("psd: invalid EXIF data")
+
+// EXIF IFDs
+const (
+	EXIFIFD0 = "IFD0"
+	EXIFIFD1 = "IFD1" // Thumbnail
+	EXIFExif = "Exif"
+	EXIFGPS  = "GPS"
+)
+
+// Common EXIF tag IDs
+const (
+	EXIFTagImageDescription  uint16 = 0x010E
+	EXIFTagMake              uint16 = 0x010F
+	EXIFTagModel             uint16 = 0x0110
+	EXIFTagOrientation       uint16 = 0x0112
+	EXIFTagXResolution       uint16 = 0x011A
+	EXIFTagYResolution       uint16 = 0x011B
+	EXIFTagResolutionUnit    uint16 = 0x0128
+	EXIFTagSoftware          uint16 = 0x0131
+	EXIFTagDateTime          uint16 = 0x0132
+	EXIFTagArtist            uint16 = 0x013B
+	EXIFTagCopyright         uint16 = 0x8298
+	EXIFTagExifIFD           uint16 = 0x8769
+	EXIFTagGPSIFD            uint16 = 0x8825
+	EXIFTagDateTimeOriginal  uint16 = 0x9003
+	EXIFTagDateTimeDigitized uint16 = 0x9004
+	EXIFTagColorSpace        uint16 = 0xA001
+	EXIFTagPixelXDimension   uint16 = 0xA002
+	EXIFTagPixelYDimension   uint16 = 0xA003
+)
+
+// TIFF field types
+const (
+	EXIFTypeByte      uint16 = 1
+	EXIFTypeASCII     uint16 = 2
+	EXIFTypeShort     uint16 = 3
+	EXIFTypeLong      uint16 = 4
+	EXIFTypeRational  uint16 = 5
+	EXIFTypeSByte     uint16 = 6
+	EXIFTypeUndefined uint16 = 7
+	EXIFTypeSShort    uint16 = 8
+	EXIFTypeSLong     uint16 = 9
+	EXIFTypeSRational uint16 = 10
+	EXIFTypeFloat     uint16 = 11
+	EXIFTypeDouble    uint16 = 12
+)
+
+// exifTypeSizes is the size in bytes of one value of each field type
+var exifTypeSizes = map[uint16]int{
+	EXIFTypeByte: 1, EXIFTypeASCII: 1, EXIFTypeShort: 2, EXIFTypeLong: 4,
+	EXIFTypeRational: 8, EXIFTypeSByte: 1, EXIFTypeUndefined: 1, EXIFTypeSShort: 2,
+	EXIFTypeSLong: 4, EXIFTypeSRational: 8, EXIFTypeFloat: 4, EXIFTypeDouble: 8,
+}
+
+// maxEXIFTags limits the number of tags read, against corrupt IFD chains
+const maxEXIFTags = 4096
+
+// EXIFTag is a field of an EXIF IFD. Value holds a string for ASCII fields,
+// []byte for byte and undefined fields, []int64 for integer fields and
+// []float64 for rational and floating point fields.
+type EXIFTag struct {
+	IFD   string
+	ID    uint16
+	Type  uint16
+	Count uint32
+	Value any
+}
+
+// String returns the value of an ASCII field
+func (t *EXIFTag) String() string {
+	s, _ := t.Value.(string)
+	return s
+}
+
+// Int returns the first value of an integer field
+func (t *EXIFTag) Int() (int64, bool) {
+	if values, ok := t.Value.([]int64); ok && len(values) > 0 {
+		return values[0], true
+	}
+	return 0, false
+}
+
+// Float returns the first value of a numeric field
+func (t *EXIFTag) Float() (float64, bool) {
+	switch values := t.Value.(type) {
+	case []float64:
+		if len(values) > 0 {
+			return values[0], true
+		}
+	case []int64:
+		if len(values) > 0 {
+			return float64(values[0]), true
+		}
+	}
+	return 0, false
+}
+
+// EXIFData represents the EXIF data resource (ID 1058, or 1059 for EXIF 3)
+type EXIFData struct {
+	ByteOrder binary.ByteOrder
+	Tags      []EXIFTag
+
+	ImageDescription string
+	Make             string
+	Model            string
+	Software         string
+	Artist           string
+	Copyright        string
+	DateTime         string
+	DateTimeOriginal string
+	Orientation      int
+}
+
+// Tag returns the first tag with the given ID in any IFD
+func (e *EXIFData) Tag(id uint16) (*EXIFTag, bool) {
+	for i := range e.Tags {
+		if e.Tags[i].ID == id {
+			return &e.Tags[i], true
+		}
+	}
+	return nil, false
+}
+
+// Created returns DateTimeOriginal, or DateTime if it is missing
+func (e *EXIFData) Created() (time.Time, error) {
+	value := e.DateTimeOriginal
+	if value == "" {
+		value = e.DateTime
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid EXIF date: %q", value)
+	}
+	return t, nil
+}
+
+// ParseEXIF parses the EXIF data, preferring 1058 over 1059. It returns nil
+// if the document has none.
+func (r *ResourceSection) ParseEXIF() (*EXIFData, error) {
+	data := r.resourceData(resourceEXIF1)
+	if len(data) == 0 {
+		data = r.resourceData(resourceEXIF3)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parseEXIF(data)
+}
+
+func parseEXIF(data []byte) (*EXIFData, error) {
+	// Some writers keep the "Exif\0\0" prefix of the JPEG APP1 segment
+	if len(data) >= 6 && string(data[:6]) == "Exif\x00\x00" {
+		data = data[6:]
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEXIF, errTruncatedRead)
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: byte order %q", ErrInvalidEXIF, data[:2])
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, fmt.Errorf("%w: bad TIFF magic", ErrInvalidEXIF)
+	}
+
+	r := &exifReader{data: data, order: order, visited: make(map[uint32]bool)}
+	if err := r.readIFDChain(order.Uint32(data[4:])); err != nil {
+		return nil, err
+	}
+
+	e := &EXIFData{ByteOrder: order, Tags: r.tags}
+	e.ImageDescription = e.stringTag(EXIFTagImageDescription)
+	e.Make = e.stringTag(EXIFTagMake)
+	e.Model = e.stringTag(EXIFTagModel)
+	e.Software = e.stringTag(EXIFTagSoftware)
+	e.Artist = e.stringTag(EXIFTagArtist)
+	e.Copyright = e.stringTag(EXIFTagCopyright)
+	e.DateTime = e.stringTag(EXIFTagDateTime)
+	e.DateTimeOriginal = e.stringTag(EXIFTagDateTimeOriginal)
+	if tag, ok := e.Tag(EXIFTagOrientation); ok {
+		orientation, _ := tag.Int()
+		e.Orientation = int(orientation)
+	}
+	return e, nil
+}
+
+func (e *EXIFData) stringTag(id uint16) string {
+	if tag, ok := e.Tag(id); ok {
+		return tag.String()
+	}
+	return ""
+}
+
+// exifReader walks the IFDs of a TIFF structure
+type exifReader struct {
+	data    []byte
+	order   binary.ByteOrder
+	tags    []EXIFTag
+	visited map[uint32]bool
+}
+
+// readIFDChain reads IFD0 and the IFDs linked after it
+func (r *exifReader) readIFDChain(offset uint32) error {
+	for index := 0; offset != 0; index++ {
+		next, err := r.readIFD(offset, fmt.Sprintf("IFD%d", index))
+		if err != nil {
+			return err
+		}
+		offset = next
+	}
+	return nil
+}
+
+// readIFD reads the IFD at offset, following the Exif and GPS IFD pointers,
+// and returns the offset of the next IFD
+func (r *exifReader) readIFD(offset uint32, ifd string) (uint32, error) {
+	if r.visited[offset] {
+		return 0, fmt.Errorf("%w: IFD loop at offset %d", ErrInvalidEXIF, offset)
+	}
+	r.visited[offset] = true
+
+	if uint64(offset)+2 > uint64(len(r.data)) {
+		return 0, fmt.Errorf("%w: IFD offset %d out of range", ErrInvalidEXIF, offset)
+	}
+	count := int(r.order.Uint16(r.data[offset:]))
+	entries := int(offset) + 2
+	if entries+count*12+4 > len(r.data) {
+		return 0, fmt.Errorf("%w: IFD at offset %d: %w", ErrInvalidEXIF, offset, errTruncatedRead)
+	}
+	if len(r.tags)+count > maxEXIFTags {
+		return 0, fmt.Errorf("%w: too many tags", ErrInvalidEXIF)
+	}
+
+	for i := 0; i < count; i++ {
+		entry := r.data[entries+i*12:]
+		tag := EXIFTag{
+			IFD:   ifd,
+			ID:    r.order.Uint16(entry[0:]),
+			Type:  r.order.Uint16(entry[2:]),
+			Count: r.order.Uint32(entry[4:]),
+		}
+		value, ok := r.fieldData(tag.Type, tag.Count, entry[8:12])
+		if !ok {
+			// Unknown type or out of range value; skip the field
+			continue
+		}
+		tag.Value = r.decodeValue(tag.Type, tag.Count, value)
+		r.tags = append(r.tags, tag)
+
+		var sub string
+		switch {
+		case ifd == EXIFIFD0 && tag.ID == EXIFTagExifIFD:
+			sub = EXIFExif
+		case ifd == EXIFIFD0 && tag.ID == EXIFTagGPSIFD:
+			sub = EXIFGPS
+		default:
+			continue
+		}
+		if pointer, ok := tag.Int(); ok && pointer > 0 && pointer <= math.MaxUint32 {
+			if _, err := r.readIFD(uint32(pointer), sub); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return r.order.Uint32(r.data[entries+count*12:]), nil
+}
+
+// fieldData returns the bytes of a field's values, which are stored in the
+// entry itself when they fit in four bytes
+func (r *exifReader) fieldData(typ uint16, count uint32, inline []byte) ([]byte, bool) {
+	size, ok := exifTypeSizes[typ]
+	if !ok {
+		return nil, false
+	}
+	total := uint64(size) * uint64(count)
+	if total <= 4 {
+		return inline[:total], true
+	}
+	offset := uint64(r.order.Uint32(inline))
+	if offset+total > uint64(len(r.data)) {
+		return nil, false
+	}
+	return r.data[offset : offset+total], true
+}
+
+// decodeValue converts field bytes to the Go type documented on EXIFTag
+func (r *exifReader) decodeValue(typ uint16, count uint32, data []byte) any {
+	n := int(count)
+	switch typ {
+	case EXIFTypeASCII:
+		return strings.TrimRight(string(data), "\x00 ")
+	case EXIFTypeByte, EXIFTypeUndefined:
+		return data
+	case EXIFTypeSByte:
+		values := make([]int64, n)
+		for i := range values {
+			values[i] = int64(int8(data[i]))
+		}
+		return values
+	case EXIFTypeShort, EXIFTypeSShort:
+		values := make([]int64, n)
+		for i := range values {
+			v := r.order.Uint16(data[i*2:])
+			if typ == EXIFTypeSShort {
+				values[i] = int64(int16(v))
+			} else {
+				values[i] = int64(v)
+			}
+		}
+		return values
+	case EXIFTypeLong, EXIFTypeSLong:
+		values := make([]int64, n)
+		for i := range values {
+			v := r.order.Uint32(data[i*4:])
+			if typ == EXIFTypeSLong {
+				values[i] = int64(int32(v))
+			} else {
+				values[i] = int64(v)
+			}
+		}
+		return values
+	case EXIFTypeRational, EXIFTypeSRational:
+		values := make([]float64, n)
+		for i := range values {
+			num, den := r.order.Uint32(data[i*8:]), r.order.Uint32(data[i*8+4:])
+			if den == 0 {
+				continue
+			}
+			if typ == EXIFTypeSRational {
+				values[i] = float64(int32(num)) / float64(int32(den))
+			} else {
+				values[i] = float64(num) / float64(den)
+			}
+		}
+		return values
+	case EXIFTypeFloat:
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(r.order.Uint32(data[i*4:])))
+		}
+		return values
+	case EXIFTypeDouble:
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = math.Float64frombits(r.order.Uint64(data[i*8:]))
+		}
+		return values
+	}
+	return data
+}
+
+// EXIF returns the document's EXIF data, or nil if it has none
+func (p *PSD) EXIF() (*EXIFData, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseEXIF()
+}
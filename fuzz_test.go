@@ -0,0 +1,113 @@
+package psd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// fuzzLimits keep fuzzing inputs from using more memory than the fuzzer
+// allows
+var fuzzLimits = Limits{
+	MaxWidth:        4096,
+	MaxHeight:       4096,
+	MaxDecodedBytes: 64 << 20,
+	MaxResourceSize: 16 << 20,
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(errorDoc().build())
+	f.Add(zipDoc(16, CompressionZIPPrediction, samples16(1, 2, 3, 4, 5, 6), samples16(6, 5, 4, 3, 2, 1), samples16(0, 0, 0, 0, 0, 0)).build())
+	psb := errorDoc()
+	psb.version = 2
+	f.Add(psb.build())
+	if data, err := os.ReadFile("testdata/pixel.psd"); err == nil {
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, lenient := range []bool{false, true} {
+			psd, err := NewFromBytes(data)
+			if err != nil {
+				return
+			}
+			if err := psd.ParseWithOptions(ParseOptions{Lenient: lenient, Limits: fuzzLimits}); err != nil {
+				continue
+			}
+			for _, layer := range psd.Layers() {
+				layer.ToImage()
+			}
+			psd.Image().ToPNG()
+			psd.Slices()
+			psd.Guides()
+		}
+	})
+}
+
+func FuzzParseTypeTool(f *testing.F) {
+	if psd, err := New("testdata/example.psd"); err == nil {
+		for _, layer := range psd.Layers() {
+			if data, ok := layer.LayerInfo["TySh"]; ok {
+				f.Add(data)
+			}
+		}
+		psd.Close()
+	}
+	f.Add([]byte{0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseTypeTool(data)
+	})
+}
+
+func FuzzParseICCProfile(f *testing.F) {
+	if psd, err := New("testdata/example.psd"); err == nil {
+		if data := psd.Resources().resourceData(resourceICCProfile); data != nil {
+			f.Add(data)
+		}
+		psd.Close()
+	}
+	f.Add(cmykProfile())
+	f.Add(buildICC(ICCColorSpaceGray, ICCColorSpaceLab, map[string][]byte{"A2B0": grayLutAToB()}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		profile, err := ParseICCProfile(data)
+		if err != nil {
+			return
+		}
+		in := []float64{0, 0.25, 0.5, 0.75, 1}
+		profile.ToSRGB(in[:min(len(in), profile.channels())])
+		profile.ToSRGB(in)
+	})
+}
+
+func FuzzDescriptorParser(f *testing.F) {
+	f.Add(testDescriptor(1))
+	f.Add(testDescriptor(100))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		NewDescriptorParser(data).Parse()
+	})
+}
+
+// testDescriptor returns a descriptor nesting depth objects
+func testDescriptor(depth int) []byte {
+	buf := new(bytes.Buffer)
+	writeBE(buf, uint32(0)) // empty class name
+	writeBE(buf, uint32(0))
+	buf.WriteString("null")
+	if depth <= 1 {
+		writeBE(buf, uint32(1))
+		writeBE(buf, uint32(0))
+		buf.WriteString("Nm  ")
+		buf.WriteString("long")
+		writeBE(buf, int32(7))
+		return buf.Bytes()
+	}
+	writeBE(buf, uint32(1))
+	writeBE(buf, uint32(0))
+	buf.WriteString("chld")
+	buf.WriteString("Objc")
+	buf.Write(testDescriptor(depth - 1))
+	return buf.Bytes()
+}
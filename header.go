@@ -2,11 +2,13 @@ package psd
 
 import (
 	"fmt"
+	"image/color"
 )
 
 // Header represents the PSD file header
 type Header struct {
 	file     *File
+	state    *parseState
 	Sig      string
 	Version  uint16
 	Channels uint16
@@ -14,6 +16,11 @@ type Header struct {
 	Cols     uint32
 	Depth    uint16
 	Mode     uint16
+
+	// ColorModeData holds the color mode data section: the 768-byte
+	// palette for Indexed documents and the duotone specification for
+	// Duotone documents. It is empty for other modes.
+	ColorModeData []byte
 }
 
 // Color modes
@@ -78,6 +85,67 @@ func (h *Header) IsBig() bool {
 	return h.Version == 2
 }
 
+// LengthSize returns the width in bytes of the section, channel and
+// large additional layer info length fields: 4 for PSD and 8 for PSB
+func (h *Header) LengthSize() int {
+	if h.IsBig() {
+		return 8
+	}
+	return 4
+}
+
+// RLECountSize returns the width in bytes of each scanline byte count in
+// RLE compressed data: 2 for PSD and 4 for PSB
+func (h *Header) RLECountSize() int {
+	if h.IsBig() {
+		return 4
+	}
+	return 2
+}
+
+// BytesPerRow returns the number of bytes in one uncompressed scanline of
+// width samples at the document's bit depth
+func (h *Header) BytesPerRow(width int) int {
+	if h.Depth == 1 {
+		return (width + 7) / 8
+	}
+	return width * int(h.Depth/8)
+}
+
+// ColorChannels returns the number of colour channels for the colour mode.
+// Any channels beyond these are alpha or spot channels. Multichannel
+// documents treat every channel as a colour channel.
+func (h *Header) ColorChannels() int {
+	switch h.Mode {
+	case ColorModeRGBColor, ColorModeLabColor:
+		return 3
+	case ColorModeCMYKColor:
+		return 4
+	case ColorModeMultichannel:
+		return int(h.Channels)
+	default:
+		return 1
+	}
+}
+
+// ColorModel returns the color.Model of the images the document decodes
+// to. Every colour mode is converted to RGB, so this is color.RGBAModel as
+// returned by Image.ToPNG and Layer.ToImage, or color.NRGBA64Model as
+// returned by the 16-bit ToNRGBA64 and ToImage64 for 16 and 32-bit
+// documents. Indexed documents return their palette, the model of
+// Image.ToPaletted. Use Mode for the colour mode the document is stored in.
+func (h *Header) ColorModel() color.Model {
+	if h.Mode == ColorModeIndexedColor {
+		if palette := h.Palette(); palette != nil {
+			return palette
+		}
+	}
+	if h.Depth > 8 {
+		return color.NRGBA64Model
+	}
+	return color.RGBAModel
+}
+
 // IsRGB returns true if the color mode is RGB
 func (h *Header) IsRGB() bool {
 	return h.Mode == ColorModeRGBColor
@@ -88,6 +156,66 @@ func (h *Header) IsCMYK() bool {
 	return h.Mode == ColorModeCMYKColor
 }
 
+// IsIndexed returns true if the color mode is Indexed
+func (h *Header) IsIndexed() bool {
+	return h.Mode == ColorModeIndexedColor
+}
+
+// IsBitmap returns true if the color mode is Bitmap (1 bit per pixel)
+func (h *Header) IsBitmap() bool {
+	return h.Mode == ColorModeBitmap
+}
+
+// IsDuotone returns true if the color mode is Duotone
+func (h *Header) IsDuotone() bool {
+	return h.Mode == ColorModeDuotone
+}
+
+// Palette returns the colour table of an Indexed document, or nil for other
+// modes. The color mode data stores 256 red values, then 256 green values,
+// then 256 blue values.
+func (h *Header) Palette() color.Palette {
+	if !h.IsIndexed() || len(h.ColorModeData) < 768 {
+		return nil
+	}
+
+	palette := make(color.Palette, 256)
+	for i := 0; i < 256; i++ {
+		palette[i] = color.RGBA{
+			R: h.ColorModeData[i],
+			G: h.ColorModeData[256+i],
+			B: h.ColorModeData[512+i],
+			A: 255,
+		}
+	}
+	return palette
+}
+
+// DuotoneData returns the raw duotone specification of a Duotone document,
+// or nil for other modes. Its format is undocumented; Duotone images are
+// decoded as grayscale.
+func (h *Header) DuotoneData() []byte {
+	if !h.IsDuotone() {
+		return nil
+	}
+	return h.ColorModeData
+}
+
+// IsGrayscale returns true if the color mode is Grayscale
+func (h *Header) IsGrayscale() bool {
+	return h.Mode == ColorModeGrayscale
+}
+
+// IsLab returns true if the color mode is Lab
+func (h *Header) IsLab() bool {
+	return h.Mode == ColorModeLabColor
+}
+
+// IsMultichannel returns true if the color mode is Multichannel
+func (h *Header) IsMultichannel() bool {
+	return h.Mode == ColorModeMultichannel
+}
+
 // Parse parses the header section
 func (h *Header) Parse() error {
 	// Read signature (4 bytes)
@@ -96,7 +224,7 @@ func (h *Header) Parse() error {
 		return fmt.Errorf("failed to read signature: %w", err)
 	}
 	if sig != "8BPS" {
-		return fmt.Errorf("invalid PSD signature: %s", sig)
+		return fmt.Errorf("%w: signature %q", ErrNotPSD, sig)
 	}
 	h.Sig = sig
 
@@ -106,7 +234,7 @@ func (h *Header) Parse() error {
 		return fmt.Errorf("failed to read version: %w", err)
 	}
 	if version != 1 && version != 2 {
-		return fmt.Errorf("unsupported PSD version: %d", version)
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
 	}
 	h.Version = version
 
@@ -141,6 +269,9 @@ func (h *Header) Parse() error {
 	if err != nil {
 		return fmt.Errorf("failed to read depth: %w", err)
 	}
+	if depth != 1 && depth != 8 && depth != 16 && depth != 32 {
+		return fmt.Errorf("unsupported bit depth: %d", depth)
+	}
 	h.Depth = depth
 
 	// Read color mode (2 bytes)
@@ -150,14 +281,22 @@ func (h *Header) Parse() error {
 	}
 	h.Mode = mode
 
-	// Read and skip color mode data
+	if err := h.state.limits().checkSize("document", int64(h.Cols), int64(h.Rows)); err != nil {
+		return err
+	}
+
+	// Read color mode data
 	colorDataLen, err := h.file.ReadUint32()
 	if err != nil {
 		return fmt.Errorf("failed to read color data length: %w", err)
 	}
 	if colorDataLen > 0 {
-		if err := h.file.Skip(int64(colorDataLen)); err != nil {
-			return fmt.Errorf("failed to skip color data: %w", err)
+		if err := h.state.limits().checkResource("color mode data", uint64(colorDataLen)); err != nil {
+			return err
+		}
+		h.ColorModeData, err = h.file.ReadBytes(uint64(colorDataLen))
+		if err != nil {
+			return fmt.Errorf("failed to read color data: %w", err)
 		}
 	}
 
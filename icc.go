@@ -0,0 +1,736 @@
+package psd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// resourceICCProfile is the ID of the embedded ICC profile resource
+const resourceICCProfile = 1039
+
+// ErrInvalidICCProfile is returned for ICC profiles that cannot be parsed
+var ErrInvalidICCProfile = errors.New("psd: invalid ICC profile")
+
+// ICC colour space signatures
+const (
+	ICCColorSpaceRGB  = "RGB "
+	ICCColorSpaceCMYK = "CMYK"
+	ICCColorSpaceGray = "GRAY"
+	ICCColorSpaceLab  = "Lab "
+	ICCColorSpaceXYZ  = "XYZ "
+)
+
+// ICCHeader is the fixed 128-byte header of an ICC profile
+type ICCHeader struct {
+	Size            uint32
+	CMM             string
+	Version         uint32 // Major, minor and bug fix revision in the top three bytes
+	Class           string // e.g. "mntr" for displays, "prtr" for printers
+	ColorSpace      string // Device colour space, e.g. "RGB " or "CMYK"
+	PCS             string // Profile connection space: "XYZ " or "Lab "
+	Created         time.Time
+	Platform        string
+	Flags           uint32
+	Manufacturer    string
+	Model           uint32
+	RenderingIntent uint32
+	Illuminant      XYZNumber
+	Creator         string
+	ID              [16]byte
+}
+
+// VersionString returns the profile version as "major.minor.bugfix"
+func (h ICCHeader) VersionString() string {
+	return fmt.Sprintf("%d.%d.%d", h.Version>>24, (h.Version>>20)&0xf, (h.Version>>16)&0xf)
+}
+
+// XYZNumber is a CIE XYZ colour
+type XYZNumber struct {
+	X, Y, Z float64
+}
+
+// ICCCurve is a tone reproduction curve stored as a curveType ("curv") or a
+// parametricCurveType ("para")
+type ICCCurve struct {
+	Type string // "curv" or "para"
+
+	// Table holds the samples of a sampled curve. Without samples the
+	// curve is the gamma function x^Gamma, or the identity if Gamma is 0.
+	Table []uint16
+	Gamma float64
+
+	// FunctionType and Params describe a parametric curve
+	FunctionType uint16
+	Params       []float64
+}
+
+// Eval applies the curve to x in [0, 1]
+func (c *ICCCurve) Eval(x float64) float64 {
+	x = clamp01(x)
+	if c.Type == "para" {
+		return clamp01(c.evalParametric(x))
+	}
+	if len(c.Table) == 0 {
+		if c.Gamma != 0 {
+			return math.Pow(x, c.Gamma)
+		}
+		return x
+	}
+	pos := x * float64(len(c.Table)-1)
+	i := int(pos)
+	if i >= len(c.Table)-1 {
+		return float64(c.Table[len(c.Table)-1]) / 65535
+	}
+	f := pos - float64(i)
+	return (float64(c.Table[i])*(1-f) + float64(c.Table[i+1])*f) / 65535
+}
+
+func (c *ICCCurve) evalParametric(x float64) float64 {
+	p := c.Params
+	pow := func(v, g float64) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return math.Pow(v, g)
+	}
+	switch c.FunctionType {
+	case 0:
+		return pow(x, p[0])
+	case 1:
+		if x >= -p[2]/p[1] {
+			return pow(p[1]*x+p[2], p[0])
+		}
+		return 0
+	case 2:
+		if x >= -p[2]/p[1] {
+			return pow(p[1]*x+p[2], p[0]) + p[3]
+		}
+		return p[3]
+	case 3:
+		if x >= p[4] {
+			return pow(p[1]*x+p[2], p[0])
+		}
+		return p[3] * x
+	default:
+		if x >= p[4] {
+			return pow(p[1]*x+p[2], p[0]) + p[5]
+		}
+		return p[3]*x + p[6]
+	}
+}
+
+// ICCLut is a multi-dimensional lookup table tag: lut8Type ("mft1"),
+// lut16Type ("mft2") or lutAToBType ("mAB "). Values are evaluated through
+// the A curves, the colour lookup table, the M curves, the matrix and the B
+// curves in turn; stages a tag does not have are skipped. The curves of
+// "mft1" and "mft2" tables are stored as A (input) and B (output) curves.
+type ICCLut struct {
+	Type           string
+	InputChannels  int
+	OutputChannels int
+
+	ACurves []*ICCCurve
+	// GridPoints holds the number of grid points of each input dimension
+	// and CLUT the output values in [0, 1], with the last input varying
+	// fastest
+	GridPoints []int
+	CLUT       []float64
+	MCurves    []*ICCCurve
+	// Matrix is a 3x3 matrix followed by an offset, used by "mAB " tables
+	Matrix  *[12]float64
+	BCurves []*ICCCurve
+}
+
+// Eval converts input values in [0, 1] to output values in [0, 1]
+func (l *ICCLut) Eval(in []float64) []float64 {
+	values := make([]float64, len(in))
+	copy(values, in)
+	applyCurves(l.ACurves, values)
+
+	if l.CLUT != nil {
+		values = l.interpolate(values)
+	}
+
+	applyCurves(l.MCurves, values)
+
+	if l.Matrix != nil && len(values) == 3 {
+		m := l.Matrix
+		x, y, z := values[0], values[1], values[2]
+		values[0] = clamp01(m[0]*x + m[1]*y + m[2]*z + m[9])
+		values[1] = clamp01(m[3]*x + m[4]*y + m[5]*z + m[10])
+		values[2] = clamp01(m[6]*x + m[7]*y + m[8]*z + m[11])
+	}
+
+	applyCurves(l.BCurves, values)
+	return values
+}
+
+func applyCurves(curves []*ICCCurve, values []float64) {
+	for i, curve := range curves {
+		if i < len(values) && curve != nil {
+			values[i] = curve.Eval(values[i])
+		}
+	}
+}
+
+// interpolate looks up in in the colour lookup table with multilinear
+// interpolation
+func (l *ICCLut) interpolate(in []float64) []float64 {
+	n := len(l.GridPoints)
+	out := make([]float64, l.OutputChannels)
+
+	// Base grid index and fraction of each dimension
+	base := make([]int, n)
+	frac := make([]float64, n)
+	stride := make([]int, n)
+	s := l.OutputChannels
+	for d := n - 1; d >= 0; d-- {
+		stride[d] = s
+		s *= l.GridPoints[d]
+
+		pos := clamp01(in[d]) * float64(l.GridPoints[d]-1)
+		base[d] = int(pos)
+		if base[d] >= l.GridPoints[d]-1 {
+			base[d] = max(l.GridPoints[d]-2, 0)
+		}
+		frac[d] = pos - float64(base[d])
+	}
+
+	// Sum the 2^n corners of the enclosing cell
+	for corner := 0; corner < 1<<n; corner++ {
+		weight := 1.0
+		offset := 0
+		for d := 0; d < n; d++ {
+			idx := base[d]
+			if corner&(1<<d) != 0 {
+				weight *= frac[d]
+				idx++
+			} else {
+				weight *= 1 - frac[d]
+			}
+			if idx >= l.GridPoints[d] {
+				idx = l.GridPoints[d] - 1
+			}
+			offset += idx * stride[d]
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += weight * l.CLUT[offset+o]
+		}
+	}
+	return out
+}
+
+// ICCProfile is an ICC colour profile (resource 1039). Tags the parser does
+// not interpret are kept raw in Tags.
+type ICCProfile struct {
+	Header      ICCHeader
+	Description string
+	Tags        map[string][]byte
+
+	MediaWhitePoint *XYZNumber
+
+	// Matrix/TRC profiles: colorants and tone curves of RGB profiles, and
+	// the tone curve of gray profiles
+	RedColorant, GreenColorant, BlueColorant *XYZNumber
+	RedTRC, GreenTRC, BlueTRC, GrayTRC       *ICCCurve
+
+	// Device to PCS lookup tables for the perceptual, relative
+	// colorimetric and saturation intents
+	AToB0, AToB1, AToB2 *ICCLut
+
+	// Data is the raw profile
+	Data []byte
+}
+
+// ParseICCProfile parses an ICC profile. Tags of unsupported types are left
+// unparsed; ToSRGB reports whether the profile can convert colours.
+func ParseICCProfile(data []byte) (*ICCProfile, error) {
+	if len(data) < 132 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidICCProfile, errTruncatedRead)
+	}
+	if string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%w: missing acsp signature", ErrInvalidICCProfile)
+	}
+
+	p := &ICCProfile{Data: data, Tags: make(map[string][]byte)}
+	p.Header = parseICCHeader(data)
+
+	count := binary.BigEndian.Uint32(data[128:])
+	if uint64(count)*12 > uint64(len(data)-132) {
+		return nil, fmt.Errorf("%w: invalid tag count %d", ErrInvalidICCProfile, count)
+	}
+	for i := 0; i < int(count); i++ {
+		entry := data[132+i*12:]
+		sig := string(entry[0:4])
+		offset := uint64(binary.BigEndian.Uint32(entry[4:]))
+		size := uint64(binary.BigEndian.Uint32(entry[8:]))
+		if offset+size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: tag %q out of bounds", ErrInvalidICCProfile, sig)
+		}
+		p.Tags[sig] = data[offset : offset+size]
+	}
+
+	if tag, ok := p.Tags["desc"]; ok {
+		p.Description = parseICCText(tag)
+	}
+	p.MediaWhitePoint = p.xyzTag("wtpt")
+	p.RedColorant = p.xyzTag("rXYZ")
+	p.GreenColorant = p.xyzTag("gXYZ")
+	p.BlueColorant = p.xyzTag("bXYZ")
+	p.RedTRC = p.curveTag("rTRC")
+	p.GreenTRC = p.curveTag("gTRC")
+	p.BlueTRC = p.curveTag("bTRC")
+	p.GrayTRC = p.curveTag("kTRC")
+	p.AToB0 = p.lutTag("A2B0")
+	p.AToB1 = p.lutTag("A2B1")
+	p.AToB2 = p.lutTag("A2B2")
+
+	return p, nil
+}
+
+func parseICCHeader(data []byte) ICCHeader {
+	u32 := func(off int) uint32 { return binary.BigEndian.Uint32(data[off:]) }
+	u16 := func(off int) int { return int(binary.BigEndian.Uint16(data[off:])) }
+	return ICCHeader{
+		Size:            u32(0),
+		CMM:             string(data[4:8]),
+		Version:         u32(8),
+		Class:           string(data[12:16]),
+		ColorSpace:      string(data[16:20]),
+		PCS:             string(data[20:24]),
+		Created:         time.Date(u16(24), time.Month(u16(26)), u16(28), u16(30), u16(32), u16(34), 0, time.UTC),
+		Platform:        string(data[40:44]),
+		Flags:           u32(44),
+		Manufacturer:    string(data[48:52]),
+		Model:           u32(52),
+		RenderingIntent: u32(64),
+		Illuminant:      readXYZNumber(data[68:]),
+		Creator:         string(data[80:84]),
+		ID:              [16]byte(data[84:100]),
+	}
+}
+
+// s15Fixed16 converts a signed 15.16 fixed point number
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+func readXYZNumber(data []byte) XYZNumber {
+	return XYZNumber{X: s15Fixed16(data), Y: s15Fixed16(data[4:]), Z: s15Fixed16(data[8:])}
+}
+
+func (p *ICCProfile) xyzTag(sig string) *XYZNumber {
+	tag := p.Tags[sig]
+	if len(tag) < 20 || string(tag[0:4]) != "XYZ " {
+		return nil
+	}
+	xyz := readXYZNumber(tag[8:])
+	return &xyz
+}
+
+func (p *ICCProfile) curveTag(sig string) *ICCCurve {
+	curve, _, err := parseICCCurve(p.Tags[sig])
+	if err != nil {
+		return nil
+	}
+	return curve
+}
+
+func (p *ICCProfile) lutTag(sig string) *ICCLut {
+	tag := p.Tags[sig]
+	if len(tag) < 4 {
+		return nil
+	}
+	var lut *ICCLut
+	var err error
+	switch string(tag[0:4]) {
+	case "mft1":
+		lut, err = parseLut8(tag)
+	case "mft2":
+		lut, err = parseLut16(tag)
+	case "mAB ":
+		lut, err = parseLutAToB(tag)
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return lut
+}
+
+// parseICCText reads a textDescriptionType ("desc") or a
+// multiLocalizedUnicodeType ("mluc"), returning the first record
+func parseICCText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[0:4]) {
+	case "desc":
+		n := uint64(binary.BigEndian.Uint32(tag[8:]))
+		if 12+n > uint64(len(tag)) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+			return ""
+		}
+		length := uint64(binary.BigEndian.Uint32(tag[20:]))
+		offset := uint64(binary.BigEndian.Uint32(tag[24:]))
+		if offset+length > uint64(len(tag)) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+uint64(i)*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	case "text":
+		return strings.TrimRight(string(tag[8:]), "\x00")
+	}
+	return ""
+}
+
+// parseICCCurve parses a "curv" or "para" element and returns the number of
+// bytes it takes, padded to a multiple of 4
+func parseICCCurve(data []byte) (*ICCCurve, int, error) {
+	if len(data) < 12 {
+		return nil, 0, errTruncatedRead
+	}
+	switch string(data[0:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(data[8:]))
+		size := 12 + count*2
+		if count < 0 || size > len(data) {
+			return nil, 0, errTruncatedRead
+		}
+		curve := &ICCCurve{Type: "curv"}
+		if count == 1 {
+			// A single entry is a gamma in u8Fixed8
+			curve.Gamma = float64(binary.BigEndian.Uint16(data[12:])) / 256
+		} else if count > 1 {
+			curve.Table = make([]uint16, count)
+			for i := range curve.Table {
+				curve.Table[i] = binary.BigEndian.Uint16(data[12+i*2:])
+			}
+		}
+		return curve, (size + 3) &^ 3, nil
+	case "para":
+		functionType := binary.BigEndian.Uint16(data[8:])
+		params := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}[functionType]
+		if params == 0 {
+			return nil, 0, fmt.Errorf("unsupported parametric curve type %d", functionType)
+		}
+		size := 12 + params*4
+		if size > len(data) {
+			return nil, 0, errTruncatedRead
+		}
+		curve := &ICCCurve{Type: "para", FunctionType: functionType, Params: make([]float64, params)}
+		for i := range curve.Params {
+			curve.Params[i] = s15Fixed16(data[12+i*4:])
+		}
+		return curve, (size + 3) &^ 3, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported curve type %q", data[0:4])
+}
+
+// parseICCCurves parses n consecutive curves
+func parseICCCurves(data []byte, n int) ([]*ICCCurve, error) {
+	curves := make([]*ICCCurve, n)
+	for i := range curves {
+		curve, size, err := parseICCCurve(data)
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = curve
+		// The last curve of a tag may not be padded
+		data = data[min(size, len(data)):]
+	}
+	return curves, nil
+}
+
+// tableCurve returns a sampled curve over n samples of size bytes each
+func tableCurve(data []byte, n, size int) *ICCCurve {
+	curve := &ICCCurve{Type: "curv", Table: make([]uint16, n)}
+	for i := range curve.Table {
+		if size == 1 {
+			curve.Table[i] = uint16(data[i]) * 257
+		} else {
+			curve.Table[i] = binary.BigEndian.Uint16(data[i*2:])
+		}
+	}
+	return curve
+}
+
+// gridSize returns the number of entries of a colour lookup table, or -1 if
+// it exceeds limit
+func gridSize(grid []int, outputs, limit int) int {
+	n := outputs
+	for _, g := range grid {
+		n *= g
+		if n > limit {
+			return -1
+		}
+	}
+	return n
+}
+
+// readCLUT reads n table entries of size bytes each scaled to [0, 1]
+func readCLUT(data []byte, n, size int) []float64 {
+	clut := make([]float64, n)
+	for i := range clut {
+		if size == 1 {
+			clut[i] = float64(data[i]) / 255
+		} else {
+			clut[i] = float64(binary.BigEndian.Uint16(data[i*2:])) / 65535
+		}
+	}
+	return clut
+}
+
+// parseLut8 parses a lut8Type ("mft1") tag
+func parseLut8(tag []byte) (*ICCLut, error) {
+	return parseMft(tag, 1)
+}
+
+// parseLut16 parses a lut16Type ("mft2") tag
+func parseLut16(tag []byte) (*ICCLut, error) {
+	return parseMft(tag, 2)
+}
+
+// parseMft parses an "mft1" or "mft2" tag whose tables hold samples of size
+// bytes. The matrix only applies to XYZ input and is ignored.
+func parseMft(tag []byte, size int) (*ICCLut, error) {
+	header := 48
+	if size == 2 {
+		header = 52
+	}
+	if len(tag) < header {
+		return nil, errTruncatedRead
+	}
+	in, out, grid := int(tag[8]), int(tag[9]), int(tag[10])
+	if in == 0 || out == 0 || grid < 2 {
+		return nil, fmt.Errorf("invalid lut dimensions")
+	}
+	inEntries, outEntries := 256, 256
+	if size == 2 {
+		inEntries = int(binary.BigEndian.Uint16(tag[48:]))
+		outEntries = int(binary.BigEndian.Uint16(tag[50:]))
+	}
+	if inEntries < 2 || outEntries < 2 {
+		return nil, fmt.Errorf("invalid lut table size")
+	}
+
+	gridPoints := make([]int, in)
+	for i := range gridPoints {
+		gridPoints[i] = grid
+	}
+	entries := gridSize(gridPoints, out, len(tag))
+	if entries < 0 || header+(in*inEntries+entries+out*outEntries)*size > len(tag) {
+		return nil, errTruncatedRead
+	}
+
+	lut := &ICCLut{Type: string(tag[0:4]), InputChannels: in, OutputChannels: out, GridPoints: gridPoints}
+	data := tag[header:]
+	for i := 0; i < in; i++ {
+		lut.ACurves = append(lut.ACurves, tableCurve(data, inEntries, size))
+		data = data[inEntries*size:]
+	}
+	lut.CLUT = readCLUT(data, entries, size)
+	data = data[entries*size:]
+	for i := 0; i < out; i++ {
+		lut.BCurves = append(lut.BCurves, tableCurve(data, outEntries, size))
+		data = data[outEntries*size:]
+	}
+	return lut, nil
+}
+
+// parseLutAToB parses a lutAToBType ("mAB ") tag
+func parseLutAToB(tag []byte) (*ICCLut, error) {
+	if len(tag) < 32 {
+		return nil, errTruncatedRead
+	}
+	in, out := int(tag[8]), int(tag[9])
+	if in == 0 || out == 0 {
+		return nil, fmt.Errorf("invalid lut dimensions")
+	}
+	lut := &ICCLut{Type: "mAB ", InputChannels: in, OutputChannels: out}
+
+	// Offsets of each element from the start of the tag; 0 if absent
+	offset := func(i int) (int, bool) {
+		off := int(binary.BigEndian.Uint32(tag[12+i*4:]))
+		return off, off != 0 && off < len(tag)
+	}
+
+	var err error
+	if off, ok := offset(0); ok {
+		if lut.BCurves, err = parseICCCurves(tag[off:], out); err != nil {
+			return nil, err
+		}
+	}
+	if off, ok := offset(1); ok {
+		if off+48 > len(tag) {
+			return nil, errTruncatedRead
+		}
+		var m [12]float64
+		for i := range m {
+			m[i] = s15Fixed16(tag[off+i*4:])
+		}
+		lut.Matrix = &m
+	}
+	if off, ok := offset(2); ok {
+		if lut.MCurves, err = parseICCCurves(tag[off:], out); err != nil {
+			return nil, err
+		}
+	}
+	if off, ok := offset(3); ok {
+		if off+20 > len(tag) {
+			return nil, errTruncatedRead
+		}
+		// The grid has room for 16 dimensions
+		if in > 16 {
+			return nil, fmt.Errorf("invalid lut grid")
+		}
+		lut.GridPoints = make([]int, in)
+		for i := range lut.GridPoints {
+			lut.GridPoints[i] = int(tag[off+i])
+			if lut.GridPoints[i] < 2 {
+				return nil, fmt.Errorf("invalid lut grid")
+			}
+		}
+		precision := int(tag[off+16])
+		if precision != 1 && precision != 2 {
+			return nil, fmt.Errorf("invalid lut precision %d", precision)
+		}
+		entries := gridSize(lut.GridPoints, out, len(tag))
+		if entries < 0 || off+20+entries*precision > len(tag) {
+			return nil, errTruncatedRead
+		}
+		lut.CLUT = readCLUT(tag[off+20:], entries, precision)
+	}
+	if off, ok := offset(4); ok {
+		if lut.ACurves, err = parseICCCurves(tag[off:], in); err != nil {
+			return nil, err
+		}
+	}
+	return lut, nil
+}
+
+// channels returns the number of components of the profile's colour space,
+// or 0 if it is not supported
+func (p *ICCProfile) channels() int {
+	switch p.Header.ColorSpace {
+	case ICCColorSpaceGray:
+		return 1
+	case ICCColorSpaceRGB, ICCColorSpaceLab, ICCColorSpaceXYZ:
+		return 3
+	case ICCColorSpaceCMYK:
+		return 4
+	}
+	return 0
+}
+
+// hasMatrix reports whether the profile is a complete RGB matrix/TRC profile
+func (p *ICCProfile) hasMatrix() bool {
+	return p.RedColorant != nil && p.GreenColorant != nil && p.BlueColorant != nil &&
+		p.RedTRC != nil && p.GreenTRC != nil && p.BlueTRC != nil
+}
+
+// aToB returns the lookup table used for conversion, preferring the
+// perceptual intent. Tables without a CLUT keep the number of channels, so
+// only those with three inputs map to the PCS.
+func (p *ICCProfile) aToB() *ICCLut {
+	for _, lut := range []*ICCLut{p.AToB0, p.AToB1, p.AToB2} {
+		if lut == nil || lut.CLUT == nil && lut.InputChannels != 3 {
+			continue
+		}
+		if lut.InputChannels == p.channels() && lut.OutputChannels == 3 {
+			return lut
+		}
+	}
+	return nil
+}
+
+// CanConvert reports whether ToSRGB can convert colours of this profile
+func (p *ICCProfile) CanConvert() bool {
+	if p == nil || p.channels() == 0 {
+		return false
+	}
+	switch {
+	case p.Header.ColorSpace == ICCColorSpaceRGB && p.hasMatrix():
+		return true
+	case p.Header.ColorSpace == ICCColorSpaceGray && p.GrayTRC != nil:
+		return true
+	}
+	return p.aToB() != nil
+}
+
+// ToSRGB converts device colour components in [0, 1] to display encoded
+// sRGB. Components follow the ICC encoding of the profile's colour space:
+// for CMYK, 1 is full ink coverage. It reports false if the profile cannot
+// convert colours or in has too few components.
+func (p *ICCProfile) ToSRGB(in []float64) (r, g, b float64, ok bool) {
+	if !p.CanConvert() || len(in) < p.channels() {
+		return 0, 0, 0, false
+	}
+
+	switch {
+	case p.Header.ColorSpace == ICCColorSpaceRGB && p.hasMatrix():
+		lr, lg, lb := p.RedTRC.Eval(in[0]), p.GreenTRC.Eval(in[1]), p.BlueTRC.Eval(in[2])
+		x := p.RedColorant.X*lr + p.GreenColorant.X*lg + p.BlueColorant.X*lb
+		y := p.RedColorant.Y*lr + p.GreenColorant.Y*lg + p.BlueColorant.Y*lb
+		z := p.RedColorant.Z*lr + p.GreenColorant.Z*lg + p.BlueColorant.Z*lb
+		r, g, b = xyzD50ToSRGB(x, y, z)
+		return r, g, b, true
+	case p.Header.ColorSpace == ICCColorSpaceGray && p.GrayTRC != nil:
+		y := p.GrayTRC.Eval(in[0])
+		r, g, b = xyzD50ToSRGB(labWhiteX*y, labWhiteY*y, labWhiteZ*y)
+		return r, g, b, true
+	}
+
+	lut := p.aToB()
+	pcs := lut.Eval(in[:p.channels()])
+	if p.Header.PCS == ICCColorSpaceLab {
+		// Legacy 16-bit tables encode L* 100 and a*, b* 127 as 0xFF00
+		scale := 1.0
+		if lut.Type == "mft2" {
+			scale = 65535.0 / 65280.0
+		}
+		r, g, b = labToSRGB(pcs[0]*scale*100, pcs[1]*scale*255-128, pcs[2]*scale*255-128)
+		return r, g, b, true
+	}
+	// XYZ is encoded as u1Fixed15, so 1.0 is stored as 0x8000
+	const xyzScale = 65535.0 / 32768.0
+	r, g, b = xyzD50ToSRGB(pcs[0]*xyzScale, pcs[1]*xyzScale, pcs[2]*xyzScale)
+	return r, g, b, true
+}
+
+// ParseICCProfile parses the embedded ICC profile (ID 1039). It returns nil
+// without an error if the document has none.
+func (r *ResourceSection) ParseICCProfile() (*ICCProfile, error) {
+	data := r.resourceData(resourceICCProfile)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return ParseICCProfile(data)
+}
+
+// ICCProfile returns the document's embedded ICC profile, or nil if it has
+// none
+func (p *PSD) ICCProfile() (*ICCProfile, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseICCProfile()
+}
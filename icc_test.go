@@ -0,0 +1,460 @@
+package psd
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildICC serializes a profile with the given tags in signature order
+func buildICC(space, pcs string, tags map[string][]byte) []byte {
+	sigs := make([]string, 0, len(tags))
+	for sig := range tags {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[8:], 0x04300000)
+	copy(header[12:], "mntr")
+	copy(header[16:], space)
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+
+	table := new(bytes.Buffer)
+	writeBE(table, uint32(len(sigs)))
+	data := new(bytes.Buffer)
+	offset := 128 + 4 + 12*len(sigs)
+	for _, sig := range sigs {
+		tag := tags[sig]
+		table.WriteString(sig)
+		writeBE(table, uint32(offset+data.Len()))
+		writeBE(table, uint32(len(tag)))
+		data.Write(tag)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	profile := append(header, table.Bytes()...)
+	profile = append(profile, data.Bytes()...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func fixed(v float64) uint32 {
+	return uint32(int32(math.Round(v * 65536)))
+}
+
+func xyzTag(x, y, z float64) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("XYZ \x00\x00\x00\x00")
+	writeBE(buf, []uint32{fixed(x), fixed(y), fixed(z)})
+	return buf.Bytes()
+}
+
+func curvTag(table ...uint16) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("curv\x00\x00\x00\x00")
+	writeBE(buf, uint32(len(table)))
+	writeBE(buf, table)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func paraTag(functionType uint16, params ...float64) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("para\x00\x00\x00\x00")
+	writeBE(buf, functionType)
+	writeBE(buf, uint16(0))
+	for _, p := range params {
+		writeBE(buf, fixed(p))
+	}
+	return buf.Bytes()
+}
+
+// mft2Tag returns a lut16Type with identity curves and a grid of 2 points
+func mft2Tag(in, out int, clut []uint16) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("mft2\x00\x00\x00\x00")
+	buf.Write([]byte{byte(in), byte(out), 2, 0})
+	for i := 0; i < 9; i++ {
+		writeBE(buf, uint32(0))
+	}
+	writeBE(buf, []uint16{2, 2})
+	for i := 0; i < in; i++ {
+		writeBE(buf, []uint16{0, 65535})
+	}
+	writeBE(buf, clut)
+	for i := 0; i < out; i++ {
+		writeBE(buf, []uint16{0, 65535})
+	}
+	return buf.Bytes()
+}
+
+func TestICCProfileFixture(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	profile, err := psd.ICCProfile()
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	assert.Equal(t, "sRGB IEC61966-2.1", profile.Description)
+	assert.Equal(t, "2.1.0", profile.Header.VersionString())
+	assert.Equal(t, "mntr", profile.Header.Class)
+	assert.Equal(t, ICCColorSpaceRGB, profile.Header.ColorSpace)
+	assert.Equal(t, ICCColorSpaceXYZ, profile.Header.PCS)
+	assert.Equal(t, 1998, profile.Header.Created.Year())
+	assert.InDelta(t, 0.9642, profile.Header.Illuminant.X, 1e-4)
+	require.NotNil(t, profile.RedColorant)
+	assert.InDelta(t, 0.4361, profile.RedColorant.X, 1e-4)
+	require.NotNil(t, profile.RedTRC)
+	assert.Len(t, profile.RedTRC.Table, 1024)
+	assert.True(t, profile.CanConvert())
+
+	// The sRGB profile converts to sRGB
+	for _, c := range [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.5, 0.5, 0.5}, {0, 100.0 / 255, 200.0 / 255}} {
+		r, g, b, ok := profile.ToSRGB(c)
+		require.True(t, ok)
+		assert.InDelta(t, c[0], r, 1.0/255, "%v", c)
+		assert.InDelta(t, c[1], g, 1.0/255, "%v", c)
+		assert.InDelta(t, c[2], b, 1.0/255, "%v", c)
+	}
+
+	// Documents without a profile return nil
+	doc := &testDoc{version: 1, channels: 3, width: 1, height: 1, depth: 8, mode: 3}
+	psd, err = NewFromBytes(doc.build())
+	require.NoError(t, err)
+	profile, err = psd.ICCProfile()
+	assert.NoError(t, err)
+	assert.Nil(t, profile)
+}
+
+func TestICCCurves(t *testing.T) {
+	for name, tc := range map[string]struct {
+		tag  []byte
+		x    float64
+		want float64
+	}{
+		"identity":  {curvTag(), 0.25, 0.25},
+		"gamma":     {curvTag(2 << 8), 0.5, 0.25},
+		"table":     {curvTag(0, 65535, 0), 0.25, 0.5},
+		"para 0":    {paraTag(0, 2), 0.5, 0.25},
+		"para 1":    {paraTag(1, 1, 2, -0.5), 0.75, 1},
+		"para 1 lo": {paraTag(1, 1, 2, -0.5), 0.2, 0},
+		"para 2":    {paraTag(2, 1, 1, 0, 0.25), 0.5, 0.75},
+		"para 3":    {paraTag(3, 1, 1, 0, 0.5, 0.5), 0.25, 0.125},
+		"para 4":    {paraTag(4, 1, 1, 0, 0.5, 0.5, 0.1, 0.2), 0.25, 0.325},
+	} {
+		curve, size, err := parseICCCurve(tc.tag)
+		require.NoError(t, err, name)
+		assert.Equal(t, len(tc.tag), size, name)
+		assert.InDelta(t, tc.want, curve.Eval(tc.x), 1e-4, name)
+	}
+
+	_, _, err := parseICCCurve(paraTag(9, 1))
+	assert.Error(t, err)
+	_, _, err = parseICCCurve([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x09"))
+	assert.ErrorIs(t, err, errTruncatedRead)
+}
+
+func TestICCProfileInvalid(t *testing.T) {
+	_, err := ParseICCProfile([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidICCProfile)
+
+	data := buildICC(ICCColorSpaceRGB, ICCColorSpaceXYZ, map[string][]byte{"wtpt": xyzTag(0.9642, 1, 0.8249)})
+	data[36] = 'x'
+	_, err = ParseICCProfile(data)
+	assert.ErrorIs(t, err, ErrInvalidICCProfile)
+
+	// Tags outside the profile
+	data = buildICC(ICCColorSpaceRGB, ICCColorSpaceXYZ, map[string][]byte{"wtpt": xyzTag(0.9642, 1, 0.8249)})
+	binary.BigEndian.PutUint32(data[136:], 1<<20)
+	_, err = ParseICCProfile(data)
+	assert.ErrorIs(t, err, ErrInvalidICCProfile)
+
+	// Unsupported and malformed tags are kept raw
+	profile, err := ParseICCProfile(buildICC(ICCColorSpaceCMYK, ICCColorSpaceLab, map[string][]byte{
+		"A2B0": []byte("mft2\x00\x00\x00\x00\x04\x03\x02\x00"),
+		"A2B1": []byte("mBA \x00\x00\x00\x00"),
+	}))
+	require.NoError(t, err)
+	assert.Nil(t, profile.AToB0)
+	assert.Nil(t, profile.AToB1)
+	assert.Len(t, profile.Tags, 2)
+	assert.False(t, profile.CanConvert())
+	_, _, _, ok := profile.ToSRGB([]float64{0, 0, 0, 0})
+	assert.False(t, ok)
+}
+
+// grayLutAToB returns a Gray lutAToBType tag with three unpadded B curves
+// and no CLUT, so it cannot map its one input to the PCS
+func grayLutAToB() []byte {
+	tag := new(bytes.Buffer)
+	tag.WriteString("mAB \x00\x00\x00\x00")
+	tag.Write([]byte{1, 3, 0, 0})
+	writeBE(tag, []uint32{32, 0, 0, 0, 0})
+	tag.Write(curvTag())
+	tag.Write(curvTag())
+	// A gamma curve of 14 bytes ending the tag
+	tag.WriteString("curv\x00\x00\x00\x00")
+	writeBE(tag, uint32(1))
+	writeBE(tag, uint16(2<<8))
+	return tag.Bytes()
+}
+
+func TestICCProfileUnpaddedCurves(t *testing.T) {
+	profile, err := ParseICCProfile(buildICC(ICCColorSpaceGray, ICCColorSpaceLab, map[string][]byte{"A2B0": grayLutAToB()}))
+	require.NoError(t, err)
+	require.NotNil(t, profile.AToB0)
+	require.Len(t, profile.AToB0.BCurves, 3)
+	assert.InDelta(t, 0.25, profile.AToB0.BCurves[2].Eval(0.5), 1e-9)
+
+	assert.False(t, profile.CanConvert())
+	_, _, _, ok := profile.ToSRGB([]float64{0.5})
+	assert.False(t, ok)
+
+	// A CLUT with more dimensions than its grid holds
+	tag := new(bytes.Buffer)
+	tag.WriteString("mAB \x00\x00\x00\x00")
+	tag.Write([]byte{200, 3, 0, 0})
+	writeBE(tag, []uint32{0, 0, 0, 32, 0})
+	tag.Write(fill(2, 20))
+	_, err = parseLutAToB(tag.Bytes())
+	assert.Error(t, err)
+}
+
+// cmykProfile returns a CMYK profile whose lightness only depends on black
+func cmykProfile() []byte {
+	var clut []uint16
+	for corner := 0; corner < 16; corner++ {
+		// The last input, black, varies fastest
+		l := uint16(0xff00)
+		if corner&1 != 0 {
+			l = 0
+		}
+		clut = append(clut, l, 0x8000, 0x8000)
+	}
+	return buildICC(ICCColorSpaceCMYK, ICCColorSpaceLab, map[string][]byte{
+		"desc": append([]byte("desc\x00\x00\x00\x00\x00\x00\x00\x05"), "CMYK\x00"...),
+		"A2B0": mft2Tag(4, 3, clut),
+	})
+}
+
+func TestICCProfileLut16(t *testing.T) {
+	profile, err := ParseICCProfile(cmykProfile())
+	require.NoError(t, err)
+	assert.Equal(t, "CMYK", profile.Description)
+	require.NotNil(t, profile.AToB0)
+	assert.Equal(t, []int{2, 2, 2, 2}, profile.AToB0.GridPoints)
+
+	r, g, b, ok := profile.ToSRGB([]float64{1, 0.5, 0, 0.4})
+	require.True(t, ok)
+	wr, wg, wb := labToSRGB(60, 0, 0)
+	assert.InDelta(t, wr, r, 1e-6)
+	assert.InDelta(t, wg, g, 1e-6)
+	assert.InDelta(t, wb, b, 1e-6)
+}
+
+func TestICCProfileLut8(t *testing.T) {
+	// Lightness follows the red input
+	buf := new(bytes.Buffer)
+	buf.WriteString("mft1\x00\x00\x00\x00")
+	buf.Write([]byte{3, 3, 2, 0})
+	for i := 0; i < 9; i++ {
+		writeBE(buf, uint32(0))
+	}
+	identity := make([]byte, 256)
+	for i := range identity {
+		identity[i] = byte(i)
+	}
+	for i := 0; i < 3; i++ {
+		buf.Write(identity)
+	}
+	for corner := 0; corner < 8; corner++ {
+		buf.Write([]byte{byte(255 * (corner >> 2)), 128, 128})
+	}
+	for i := 0; i < 3; i++ {
+		buf.Write(identity)
+	}
+
+	profile, err := ParseICCProfile(buildICC(ICCColorSpaceRGB, ICCColorSpaceLab, map[string][]byte{"A2B0": buf.Bytes()}))
+	require.NoError(t, err)
+	r, _, _, ok := profile.ToSRGB([]float64{0.6, 1, 0})
+	require.True(t, ok)
+	wr, _, _ := labToSRGB(60, 255*128.0/255-128, 0)
+	assert.InDelta(t, wr, r, 1.0/255)
+}
+
+func TestICCProfileLutAToB(t *testing.T) {
+	fixture, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer fixture.Close()
+	srgb, err := fixture.ICCProfile()
+	require.NoError(t, err)
+
+	// The sRGB colorants as a matrix between sRGB curves and identity
+	// B curves. XYZ is encoded as u1Fixed15.
+	const xyzScale = 65535.0 / 32768.0
+	c := []*XYZNumber{srgb.RedColorant, srgb.GreenColorant, srgb.BlueColorant}
+	matrix := []float64{
+		c[0].X, c[1].X, c[2].X,
+		c[0].Y, c[1].Y, c[2].Y,
+		c[0].Z, c[1].Z, c[2].Z,
+		0, 0, 0,
+	}
+	trc := srgb.Tags["rTRC"]
+
+	tag := new(bytes.Buffer)
+	tag.WriteString("mAB \x00\x00\x00\x00")
+	tag.Write([]byte{3, 3, 0, 0})
+	bOffset := 32
+	matrixOffset := bOffset + 3*len(curvTag())
+	mOffset := matrixOffset + 48
+	writeBE(tag, []uint32{uint32(bOffset), uint32(matrixOffset), uint32(mOffset), 0, 0})
+	for i := 0; i < 3; i++ {
+		tag.Write(curvTag())
+	}
+	for _, v := range matrix {
+		writeBE(tag, fixed(v/xyzScale))
+	}
+	for i := 0; i < 3; i++ {
+		tag.Write(trc)
+	}
+
+	profile, err := ParseICCProfile(buildICC(ICCColorSpaceRGB, ICCColorSpaceXYZ, map[string][]byte{"A2B0": tag.Bytes()}))
+	require.NoError(t, err)
+	require.NotNil(t, profile.AToB0)
+	assert.Equal(t, "mAB ", profile.AToB0.Type)
+	assert.Len(t, profile.AToB0.MCurves, 3)
+
+	for _, in := range [][]float64{{1, 0, 0}, {0.2, 0.4, 0.6}} {
+		r, g, b, ok := profile.ToSRGB(in)
+		require.True(t, ok)
+		assert.InDelta(t, in[0], r, 2.0/255, "%v", in)
+		assert.InDelta(t, in[1], g, 2.0/255, "%v", in)
+		assert.InDelta(t, in[2], b, 2.0/255, "%v", in)
+	}
+}
+
+func TestColorManagedImage(t *testing.T) {
+	doc := &testDoc{
+		version: 1, channels: 4, width: 1, height: 1, depth: 8, mode: 4,
+		resources: []testResource{{id: 1039, data: cmykProfile()}},
+		// 40% black ink; samples are stored inverted
+		composite: [][]byte{{255}, {255}, {255}, {153}},
+	}
+	data := doc.build()
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	naive := psd.Image().PixelData()[0]
+	assert.Equal(t, color.RGBA{153, 153, 153, 255}, naive)
+
+	psd, err = NewFromBytes(data)
+	require.NoError(t, err)
+	profile, err := psd.ICCProfile()
+	require.NoError(t, err)
+	psd.SetColorOptions(ColorOptions{Profile: profile})
+
+	r, g, b := labToSRGB(60, 0, 0)
+	want := color.RGBA{to8(r), to8(g), to8(b), 255}
+	assert.Equal(t, want, psd.Image().PixelData()[0])
+
+	// Profiles for another colour space are ignored
+	fixture, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer fixture.Close()
+	srgb, err := fixture.ICCProfile()
+	require.NoError(t, err)
+	psd, err = NewFromBytes(data)
+	require.NoError(t, err)
+	psd.SetColorOptions(ColorOptions{Profile: srgb})
+	assert.Equal(t, naive, psd.Image().PixelData()[0])
+}
+
+func TestEncodePNGWithProfile(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	profile, err := psd.ICCProfile()
+	require.NoError(t, err)
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(1, 1, color.RGBA{10, 20, 30, 255})
+
+	var buf bytes.Buffer
+	require.NoError(t, EncodePNG(&buf, img, profile))
+
+	decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{10, 20, 30, 255}, color.RGBAModel.Convert(decoded.At(1, 1)))
+
+	// The iCCP chunk follows IHDR
+	data := buf.Bytes()[pngHeaderSize:]
+	length := binary.BigEndian.Uint32(data)
+	assert.Equal(t, "iCCP", string(data[4:8]))
+	chunk := data[8 : 8+length]
+	name, compressed, _ := bytes.Cut(chunk, []byte{0})
+	assert.Equal(t, "ICC Profile", string(name))
+	zr, err := zlib.NewReader(bytes.NewReader(compressed[1:]))
+	require.NoError(t, err)
+	embedded, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, profile.Data, embedded)
+
+	// Profiles that don't match the PNG's colour type are skipped
+	cmyk, err := ParseICCProfile(cmykProfile())
+	require.NoError(t, err)
+	gray, err := ParseICCProfile(buildICC(ICCColorSpaceGray, ICCColorSpaceLab, map[string][]byte{"A2B0": grayLutAToB()}))
+	require.NoError(t, err)
+	grayImg := image.NewGray(image.Rect(0, 0, 2, 2))
+	for _, c := range []struct {
+		img     image.Image
+		profile *ICCProfile
+		embed   bool
+	}{
+		{img, cmyk, false},
+		{img, gray, false},
+		{grayImg, profile, false},
+		{grayImg, gray, true},
+	} {
+		buf.Reset()
+		require.NoError(t, EncodePNG(&buf, c.img, c.profile))
+		_, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		chunk := string(buf.Bytes()[pngHeaderSize+4 : pngHeaderSize+8])
+		assert.Equal(t, c.embed, chunk == "iCCP", "%T with %q profile", c.img, c.profile.Header.ColorSpace)
+	}
+}
+
+func TestSaveAsPNGWithProfile(t *testing.T) {
+	psd, err := New("testdata/pixel.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	profile, err := psd.ICCProfile()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "pixel.png")
+	require.NoError(t, psd.Tree().SaveAsPNGWithOptions(path, PNGOptions{ICCProfile: profile}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "iCCP", string(data[pngHeaderSize+4:pngHeaderSize+8]))
+}
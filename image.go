@@ -1,6 +1,7 @@
 package psd
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -8,16 +9,28 @@ import (
 
 // Image represents the flattened preview image
 type Image struct {
-	file      *File
-	header    *Header
-	width     uint32
-	height    uint32
-	pixelData []color.RGBA
-	parsed    bool
+	file        *File
+	header      *Header
+	colors      *ColorOptions
+	state       *parseState
+	width       uint32
+	height      uint32
+	channelData [][]byte
+	pixelData   []color.RGBA
+	parsed      bool
+
+	// mergedAlpha marks the first channel after the colour channels as the
+	// transparency of the composite, from the sign of the layer count
+	mergedAlpha bool
 }
 
-// Parse parses the image data
+// Parse parses the image data. On error the reserved buffers are released.
 func (img *Image) Parse() error {
+	return img.parse(context.Background())
+}
+
+// parse parses the image data, stopping between scanlines when ctx is done
+func (img *Image) parse(ctx context.Context) (err error) {
 	if img.parsed {
 		return nil
 	}
@@ -31,143 +44,242 @@ func (img *Image) Parse() error {
 		return fmt.Errorf("failed to read compression: %w", err)
 	}
 
-	totalPixels := int(img.width * img.height)
-	img.pixelData = make([]color.RGBA, totalPixels)
+	// Account for the decoded channels and the converted pixels before
+	// allocating either
+	totalPixels := int64(img.width) * int64(img.height)
+	channelBytes := int64(img.header.BytesPerRow(int(img.width))) * int64(img.height) * int64(img.header.Channels)
+	if err := img.state.reserve(channelBytes + totalPixels*4); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			img.state.release(channelBytes + totalPixels*4)
+			img.channelData, img.pixelData = nil, nil
+		}
+	}()
 
 	switch compression {
-	case 0: // Raw data
+	case CompressionRaw:
 		if err := img.parseRaw(); err != nil {
 			return err
 		}
-	case 1: // RLE compression
-		if err := img.parseRLE(); err != nil {
+	case CompressionRLE:
+		if err := img.parseRLE(ctx); err != nil {
+			return err
+		}
+	case CompressionZIP, CompressionZIPPrediction:
+		if err := img.parseZIP(compression == CompressionZIPPrediction); err != nil {
 			return err
 		}
 	default:
-		return fmt.Errorf("unsupported compression method: %d", compression)
+		return fmt.Errorf("%w: method %d", ErrUnsupportedCompression, compression)
 	}
 
+	// Convert to RGBA, a row at a time
+	pixelData := make([]color.RGBA, totalPixels)
+	pc := img.converter()
+	width := int(img.width)
+	for row := 0; row < int(img.height); row++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := row * width; i < (row+1)*width; i++ {
+			pixelData[i] = pc.rgba8(i)
+		}
+	}
+	img.pixelData = pixelData
+
 	img.parsed = true
 	return nil
 }
 
+// converter returns a pixel converter over the decoded colour channels
+func (img *Image) converter() *pixelConverter {
+	var planes [][]byte
+	channels := len(img.channelData)
+	if n := img.header.ColorChannels(); channels >= n {
+		planes = img.channelData[:n]
+	} else if channels == 1 {
+		// Grayscale
+		planes = img.channelData[:1]
+	}
+	pc := newPixelConverter(img.header, img.colors, int(img.width), planes, img.alphaPlane())
+	pc.matte = pc.alpha != nil
+	return pc
+}
+
+// alphaPlane returns the transparency channel of the composite, or nil
+func (img *Image) alphaPlane() []byte {
+	if n := img.header.ColorChannels(); img.mergedAlpha && len(img.channelData) > n {
+		return img.channelData[n]
+	}
+	return nil
+}
+
+// extraChannelsStart returns the index of the first channel after the colour
+// channels and the transparency
+func (img *Image) extraChannelsStart() int {
+	start := img.header.ColorChannels()
+	if img.mergedAlpha {
+		start++
+	}
+	return start
+}
+
 func (img *Image) parseRaw() error {
 	channels := int(img.header.Channels)
-	totalPixels := int(img.width * img.height)
+	channelSize := img.header.BytesPerRow(int(img.width)) * int(img.height)
 
 	// Read channel data
-	channelData := make([][]byte, channels)
+	img.channelData = make([][]byte, channels)
 	for i := 0; i < channels; i++ {
-		channelData[i] = make([]byte, totalPixels)
-		if _, err := img.file.Read(channelData[i]); err != nil {
+		data, err := img.file.ReadBytes(uint64(channelSize))
+		if err != nil {
 			return fmt.Errorf("failed to read channel %d: %w", i, err)
 		}
+		img.channelData[i] = data
 	}
 
-	// Convert to RGBA
-	for i := 0; i < totalPixels; i++ {
-		if img.header.IsRGB() && channels >= 3 {
-			img.pixelData[i] = color.RGBA{
-				R: channelData[0][i],
-				G: channelData[1][i],
-				B: channelData[2][i],
-				A: 255,
-			}
-		} else if channels == 1 {
-			// Grayscale
-			gray := channelData[0][i]
-			img.pixelData[i] = color.RGBA{R: gray, G: gray, B: gray, A: 255}
-		}
+	return nil
+}
+
+// parseZIP decodes a single zlib stream holding every channel, which runs to
+// the end of the file
+func (img *Image) parseZIP(prediction bool) error {
+	channels := int(img.header.Channels)
+	rowBytes := img.header.BytesPerRow(int(img.width))
+	channelSize := rowBytes * int(img.height)
+
+	// The compressed stream is only held until it is inflated
+	size := img.file.Remaining()
+	if err := img.state.reserve(size); err != nil {
+		return fmt.Errorf("failed to read ZIP data: %w", err)
+	}
+	defer img.state.release(size)
+	compressed, err := img.file.ReadBytes(uint64(size))
+	if err != nil {
+		return fmt.Errorf("failed to read ZIP data: %w", err)
+	}
+
+	data, err := decompressZIP(compressed, channelSize*channels, rowBytes, img.header.Depth, prediction)
+	if err != nil {
+		return err
+	}
+
+	img.channelData = make([][]byte, channels)
+	for ch := 0; ch < channels; ch++ {
+		img.channelData[ch] = data[ch*channelSize : (ch+1)*channelSize]
 	}
 
 	return nil
 }
 
-func (img *Image) parseRLE() error {
+func (img *Image) parseRLE(ctx context.Context) error {
 	channels := int(img.header.Channels)
 	height := int(img.height)
-	width := int(img.width)
+	rowBytes := img.header.BytesPerRow(int(img.width))
 
-	// Read byte counts for each scanline
+	// Read byte counts for each scanline (4 bytes each in PSB)
 	totalScanlines := channels * height
-	byteCounts := make([]uint16, totalScanlines)
+	if int64(totalScanlines*img.header.RLECountSize()) > img.file.Remaining() {
+		return fmt.Errorf("failed to read byte counts: %w", errTruncatedRead)
+	}
+	byteCounts := make([]uint32, totalScanlines)
 	for i := 0; i < totalScanlines; i++ {
-		count, err := img.file.ReadUint16()
+		var count uint32
+		var err error
+		if img.header.IsBig() {
+			count, err = img.file.ReadUint32()
+		} else {
+			var count16 uint16
+			count16, err = img.file.ReadUint16()
+			count = uint32(count16)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to read byte count: %w", err)
 		}
 		byteCounts[i] = count
 	}
 
-	// Decode RLE data for each channel
-	channelData := make([][]byte, channels)
+	// Read each channel's scanlines in file order, then decode the channels
+	// concurrently
+	compressed := make([][]byte, channels)
 	for ch := 0; ch < channels; ch++ {
-		channelData[ch] = make([]byte, width*height)
+		var size uint64
+		for _, count := range byteCounts[ch*height : (ch+1)*height] {
+			size += uint64(count)
+		}
+		data, err := img.file.ReadBytes(size)
+		if err != nil {
+			return fmt.Errorf("failed to read RLE data for channel %d: %w", ch, err)
+		}
+		compressed[ch] = data
+	}
 
-		pos := 0
-		for row := 0; row < height; row++ {
-			scanlineIdx := ch*height + row
-			byteCount := int(byteCounts[scanlineIdx])
+	channelData := make([][]byte, channels)
+	errs := make([]error, channels)
+	forEach(img.state.concurrency(), channels, func(ch int) {
+		channelData[ch], errs[ch] = decodeRLEChannel(ctx, compressed[ch], byteCounts[ch*height:(ch+1)*height], rowBytes)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 
-			if byteCount == 0 {
-				pos += width
-				continue
-			}
+	img.channelData = channelData
+	return nil
+}
 
-			endPos := pos + width
-			scanlineData := make([]byte, byteCount)
-			if _, err := img.file.Read(scanlineData); err != nil {
-				return fmt.Errorf("failed to read RLE scanline: %w", err)
-			}
+// decodeRLEChannel decodes the scanlines of one channel, which hold
+// byteCounts[row] bytes each, into rows of rowBytes bytes. It stops between
+// scanlines when ctx is done.
+func decodeRLEChannel(ctx context.Context, compressed []byte, byteCounts []uint32, rowBytes int) ([]byte, error) {
+	result := make([]byte, rowBytes*len(byteCounts))
+
+	offset := 0
+	for row, byteCount := range byteCounts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		scanlineData := compressed[offset : offset+int(byteCount)]
+		offset += int(byteCount)
 
-			// Decode RLE
-			dataIdx := 0
-			for pos < endPos && dataIdx < len(scanlineData) {
-				length := int(scanlineData[dataIdx])
-				dataIdx++
-
-				if length < 128 {
-					// Copy next length+1 bytes literally
-					length++
-					for i := 0; i < length && pos < endPos && dataIdx < len(scanlineData); i++ {
-						channelData[ch][pos] = scanlineData[dataIdx]
+		// Decode RLE
+		pos := row * rowBytes
+		endPos := pos + rowBytes
+		dataIdx := 0
+		for pos < endPos && dataIdx < len(scanlineData) {
+			length := int(scanlineData[dataIdx])
+			dataIdx++
+
+			if length < 128 {
+				// Copy next length+1 bytes literally
+				length++
+				for i := 0; i < length && pos < endPos && dataIdx < len(scanlineData); i++ {
+					result[pos] = scanlineData[dataIdx]
+					pos++
+					dataIdx++
+				}
+			} else if length > 128 {
+				// Repeat next byte (257-length) times
+				length = 257 - length
+				if dataIdx < len(scanlineData) {
+					val := scanlineData[dataIdx]
+					dataIdx++
+					for i := 0; i < length && pos < endPos; i++ {
+						result[pos] = val
 						pos++
-						dataIdx++
-					}
-				} else if length > 128 {
-					// Repeat next byte (257-length) times
-					length = 257 - length
-					if dataIdx < len(scanlineData) {
-						val := scanlineData[dataIdx]
-						dataIdx++
-						for i := 0; i < length && pos < endPos; i++ {
-							channelData[ch][pos] = val
-							pos++
-						}
 					}
 				}
-				// length == 128 is a no-op
 			}
+			// length == 128 is a no-op
 		}
+		// A short scanline leaves the rest of the row zeroed
 	}
 
-	// Convert to RGBA
-	totalPixels := width * height
-	for i := 0; i < totalPixels; i++ {
-		if img.header.IsRGB() && channels >= 3 {
-			img.pixelData[i] = color.RGBA{
-				R: channelData[0][i],
-				G: channelData[1][i],
-				B: channelData[2][i],
-				A: 255,
-			}
-		} else if channels == 1 {
-			gray := channelData[0][i]
-			img.pixelData[i] = color.RGBA{R: gray, G: gray, B: gray, A: 255}
-		}
-	}
-
-	return nil
+	return result, nil
 }
 
 // Width returns the image width
@@ -186,7 +298,9 @@ func (img *Image) Height() uint32 {
 	return img.height
 }
 
-// PixelData returns the raw pixel data
+// PixelData returns the raw pixel data. Despite the color.RGBA type, the
+// colour components are not premultiplied by alpha; convert with
+// color.NRGBA(c) before handing them to image packages.
 func (img *Image) PixelData() []color.RGBA {
 	if !img.parsed {
 		img.Parse()
@@ -194,6 +308,50 @@ func (img *Image) PixelData() []color.RGBA {
 	return img.pixelData
 }
 
+// HasAlpha reports whether the composite has a transparency channel. It is
+// set when the layer count in the layer and mask section is negative.
+func (img *Image) HasAlpha() bool {
+	if !img.parsed {
+		img.Parse()
+	}
+	return img.alphaPlane() != nil
+}
+
+// ExtraChannels returns the number of alpha and spot channels stored after
+// the colour channels and the transparency
+func (img *Image) ExtraChannels() int {
+	if !img.parsed {
+		img.Parse()
+	}
+	return max(len(img.channelData)-img.extraChannelsStart(), 0)
+}
+
+// ExtraChannel returns the samples of the i-th alpha or spot channel at the
+// document's bit depth, or nil if i is out of range
+func (img *Image) ExtraChannel(i int) []byte {
+	if i < 0 || i >= img.ExtraChannels() {
+		return nil
+	}
+	return img.channelData[img.extraChannelsStart()+i]
+}
+
+// ExtraChannelImage returns the i-th alpha or spot channel as an 8-bit
+// grayscale image, or nil if i is out of range. Spot channels hold ink
+// coverage inverted like CMYK channels, so 0 is full ink.
+func (img *Image) ExtraChannelImage(i int) *image.Gray {
+	data := img.ExtraChannel(i)
+	if data == nil {
+		return nil
+	}
+
+	width, height := int(img.width), int(img.height)
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	for p := 0; p < width*height; p++ {
+		gray.Pix[p], _ = sample8(data, p, width, img.header.Depth)
+	}
+	return gray
+}
+
 // ToPNG converts the image to a Go image.Image
 func (img *Image) ToPNG() *image.RGBA {
 	if !img.parsed {
@@ -206,9 +364,51 @@ func (img *Image) ToPNG() *image.RGBA {
 	for y := 0; y < int(img.height); y++ {
 		for x := 0; x < int(img.width); x++ {
 			idx := y*int(img.width) + x
-			rgba.Set(x, y, img.pixelData[idx])
+			// Pixel data is not premultiplied
+			rgba.Set(x, y, color.NRGBA(img.pixelData[idx]))
 		}
 	}
 
 	return rgba
 }
+
+// ToNRGBA64 converts the image to a 16 bits per channel image, preserving
+// the precision of 16 and 32-bit documents. 32-bit documents are tone mapped
+// with the PSD's ColorOptions.
+func (img *Image) ToNRGBA64() *image.NRGBA64 {
+	if !img.parsed {
+		img.Parse()
+	}
+
+	bounds := image.Rect(0, 0, int(img.width), int(img.height))
+	out := image.NewNRGBA64(bounds)
+
+	pc := img.converter()
+	for y := 0; y < int(img.height); y++ {
+		for x := 0; x < int(img.width); x++ {
+			out.SetNRGBA64(x, y, pc.nrgba64(y*int(img.width)+x))
+		}
+	}
+
+	return out
+}
+
+// ToPaletted returns the composite of an Indexed document as an
+// image.Paletted using the document's colour table. It returns nil for
+// other colour modes.
+func (img *Image) ToPaletted() *image.Paletted {
+	if !img.parsed {
+		img.Parse()
+	}
+
+	palette := img.header.Palette()
+	if palette == nil || len(img.channelData) == 0 {
+		return nil
+	}
+
+	bounds := image.Rect(0, 0, int(img.width), int(img.height))
+	paletted := image.NewPaletted(bounds, palette)
+	copy(paletted.Pix, img.channelData[0])
+
+	return paletted
+}
@@ -40,3 +40,75 @@ func TestImageExporting(t *testing.T) {
 	assert.Equal(t, uint32(200), b>>8)
 	assert.Equal(t, uint32(255), a>>8)
 }
+
+// alphaDoc returns a 2x1 RGB document whose composite has a transparency
+// channel and a spot channel after the colour channels
+func alphaDoc(mergedAlpha bool) *testDoc {
+	return &testDoc{
+		version: 1, channels: 5, width: 2, height: 1, depth: 8, mode: 3,
+		layers: []testLayer{{
+			name: "Layer 1", bottom: 1, right: 2, opacity: 255,
+			channels: []testChannel{{id: -1, data: []byte{255, 51}}, {id: 0, data: []byte{200, 200}}, {id: 1, data: []byte{100, 100}}, {id: 2, data: []byte{0, 0}}},
+		}},
+		mergedAlpha: mergedAlpha,
+		// The composite is flattened onto white: c = s*a + 255*(1 - a)
+		composite:            [][]byte{{200, 244}, {100, 224}, {0, 204}, {255, 51}, {10, 20}},
+		compositeCompression: 1,
+	}
+}
+
+func TestImageMergedAlpha(t *testing.T) {
+	for name, opts := range map[string]ParseOptions{
+		"layers parsed":  {},
+		"layers skipped": {SkipLayers: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			psd, err := NewFromBytes(alphaDoc(true).build())
+			require.NoError(t, err)
+			require.NoError(t, psd.ParseWithOptions(opts))
+
+			img := psd.Image()
+			assert.True(t, img.HasAlpha())
+			assert.Equal(t, []color.RGBA{{200, 100, 0, 255}, {200, 100, 0, 51}}, img.PixelData())
+
+			png := img.ToPNG()
+			assert.Equal(t, color.NRGBA{200, 100, 0, 51}, color.NRGBAModel.Convert(png.At(1, 0)))
+
+			require.Equal(t, 1, img.ExtraChannels())
+			assert.Equal(t, []byte{10, 20}, img.ExtraChannel(0))
+			assert.Equal(t, []byte{10, 20}, img.ExtraChannelImage(0).Pix)
+			assert.Nil(t, img.ExtraChannel(1))
+			assert.Nil(t, img.ExtraChannelImage(-1))
+		})
+	}
+}
+
+func TestImageWithoutMergedAlpha(t *testing.T) {
+	psd, err := NewFromBytes(alphaDoc(false).build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	// Without a negative layer count every extra channel is an alpha or
+	// spot channel and the composite is opaque
+	img := psd.Image()
+	assert.False(t, img.HasAlpha())
+	assert.False(t, psd.layerMask.loaded().MergedAlpha())
+	assert.Equal(t, color.RGBA{244, 224, 204, 255}, img.PixelData()[1])
+	require.Equal(t, 2, img.ExtraChannels())
+	assert.Equal(t, []byte{255, 51}, img.ExtraChannel(0))
+	assert.Equal(t, []byte{10, 20}, img.ExtraChannel(1))
+}
+
+func TestImageMergedAlphaFixtures(t *testing.T) {
+	for name, want := range map[string]bool{
+		"blendmodes.psd":  true,
+		"empty-layer.psd": true,
+		"example.psd":     false,
+	} {
+		psd, err := New("testdata/" + name)
+		require.NoError(t, err)
+		assert.Equal(t, want, psd.Image().HasAlpha(), name)
+		assert.Zero(t, psd.Image().ExtraChannels(), name)
+		psd.Close()
+	}
+}
@@ -0,0 +1,186 @@
+package psd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// resourceIPTC is the ID of the IPTC-NAA record resource
+const resourceIPTC = 1028
+
+// IPTC datasets of the application record (record 2)
+const (
+	IPTCObjectName         uint8 = 5
+	IPTCKeywords           uint8 = 25
+	IPTCDateCreated        uint8 = 55
+	IPTCTimeCreated        uint8 = 60
+	IPTCOriginatingProgram uint8 = 65
+	IPTCByline             uint8 = 80
+	IPTCBylineTitle        uint8 = 85
+	IPTCCity               uint8 = 90
+	IPTCProvinceState      uint8 = 95
+	IPTCCountry            uint8 = 101
+	IPTCHeadline           uint8 = 105
+	IPTCCredit             uint8 = 110
+	IPTCSource             uint8 = 115
+	IPTCCopyright          uint8 = 116
+	IPTCCaption            uint8 = 120
+)
+
+// IPTCDataSet is a single dataset of an IPTC-NAA record
+type IPTCDataSet struct {
+	Record  uint8
+	DataSet uint8
+	Data    []byte
+}
+
+// String returns the data as text. It is decoded as UTF-8 when valid and as
+// Latin-1 otherwise.
+func (d IPTCDataSet) String() string {
+	if utf8.Valid(d.Data) {
+		return string(d.Data)
+	}
+	runes := make([]rune, len(d.Data))
+	for i, b := range d.Data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// IPTCRecord represents the IPTC-NAA record resource (ID 1028) and its
+// common application record fields
+type IPTCRecord struct {
+	DataSets []IPTCDataSet
+
+	ObjectName         string
+	Keywords           []string
+	Byline             []string // Authors
+	BylineTitle        string
+	Copyright          string
+	DateCreated        string // CCYYMMDD
+	TimeCreated        string // HHMMSS±HHMM
+	Caption            string
+	Headline           string
+	Credit             string
+	Source             string
+	City               string
+	ProvinceState      string
+	Country            string
+	OriginatingProgram string
+}
+
+// Values returns the text of every dataset of the application record with
+// the given number
+func (r *IPTCRecord) Values(dataSet uint8) []string {
+	var values []string
+	for _, d := range r.DataSets {
+		if d.Record == 2 && d.DataSet == dataSet {
+			values = append(values, d.String())
+		}
+	}
+	return values
+}
+
+// Value returns the text of the first application record dataset with the
+// given number
+func (r *IPTCRecord) Value(dataSet uint8) string {
+	for _, d := range r.DataSets {
+		if d.Record == 2 && d.DataSet == dataSet {
+			return d.String()
+		}
+	}
+	return ""
+}
+
+// Created returns the creation date and time
+func (r *IPTCRecord) Created() (time.Time, error) {
+	if r.TimeCreated == "" {
+		t, err := time.Parse("20060102", r.DateCreated)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid IPTC date: %q", r.DateCreated)
+		}
+		return t, nil
+	}
+	t, err := time.Parse("20060102150405-0700", r.DateCreated+r.TimeCreated)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid IPTC date: %q %q", r.DateCreated, r.TimeCreated)
+	}
+	return t, nil
+}
+
+// ParseIPTC parses the IPTC-NAA record (ID 1028). It returns nil if the
+// document has none.
+func (r *ResourceSection) ParseIPTC() (*IPTCRecord, error) {
+	data := r.resourceData(resourceIPTC)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parseIPTC(data)
+}
+
+func parseIPTC(data []byte) (*IPTCRecord, error) {
+	record := &IPTCRecord{}
+	for pos := 0; pos < len(data); {
+		// Resource data is padded to an even length
+		if data[pos] == 0 {
+			break
+		}
+		if data[pos] != 0x1C {
+			return nil, fmt.Errorf("invalid IPTC tag marker 0x%02x at offset %d", data[pos], pos)
+		}
+		if pos+5 > len(data) {
+			return nil, fmt.Errorf("IPTC dataset: %w", errTruncatedRead)
+		}
+		d := IPTCDataSet{Record: data[pos+1], DataSet: data[pos+2]}
+		length := int(binary.BigEndian.Uint16(data[pos+3:]))
+		pos += 5
+
+		// Extended datasets store the size of their length in the low bits
+		if length&0x8000 != 0 {
+			size := length & 0x7FFF
+			if size > 4 || pos+size > len(data) {
+				return nil, fmt.Errorf("invalid IPTC extended dataset length of %d bytes", size)
+			}
+			length = 0
+			for _, b := range data[pos : pos+size] {
+				length = length<<8 | int(b)
+			}
+			pos += size
+		}
+		if length < 0 || length > len(data)-pos {
+			return nil, fmt.Errorf("IPTC dataset %d:%d: %w", d.Record, d.DataSet, errTruncatedRead)
+		}
+		d.Data = data[pos : pos+length]
+		pos += length
+		record.DataSets = append(record.DataSets, d)
+	}
+
+	record.ObjectName = record.Value(IPTCObjectName)
+	record.Keywords = record.Values(IPTCKeywords)
+	record.Byline = record.Values(IPTCByline)
+	record.BylineTitle = record.Value(IPTCBylineTitle)
+	record.Copyright = record.Value(IPTCCopyright)
+	record.DateCreated = record.Value(IPTCDateCreated)
+	record.TimeCreated = record.Value(IPTCTimeCreated)
+	record.Caption = record.Value(IPTCCaption)
+	record.Headline = record.Value(IPTCHeadline)
+	record.Credit = record.Value(IPTCCredit)
+	record.Source = record.Value(IPTCSource)
+	record.City = record.Value(IPTCCity)
+	record.ProvinceState = record.Value(IPTCProvinceState)
+	record.Country = record.Value(IPTCCountry)
+	record.OriginatingProgram = record.Value(IPTCOriginatingProgram)
+	return record, nil
+}
+
+// IPTC returns the document's IPTC-NAA record, or nil if it has none
+func (p *PSD) IPTC() (*IPTCRecord, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseIPTC()
+}
@@ -1,16 +1,21 @@
 package psd
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
+	"io"
 	"strings"
+	"sync"
 )
 
 // Layer represents a single layer in the PSD
 type Layer struct {
 	file   *File
 	header *Header
+	colors *ColorOptions
 
 	// Layer record fields
 	Top    int32
@@ -31,11 +36,25 @@ type Layer struct {
 	LayerInfo map[string][]byte
 
 	// Parsed layer info
-	TypeTool     *TypeToolInfo
-	fillOpacity  *uint8 // Parsed from "iOpa" layer info, default 255
-
-	// Channel image data
-	channels    map[int16]*ChannelImage
+	TypeTool    *TypeToolInfo
+	fillOpacity *uint8 // Parsed from "iOpa" layer info, default 255
+
+	// Channel image data. Decoded channels are never modified; loading and
+	// releasing replace the maps under mu.
+	state          *parseState
+	index          int   // record index in file order, for errors
+	recordEnd      int64 // end of the layer record, once known
+	channelOffsets []int64
+	mu             sync.Mutex
+	decodedBytes   int64 // decoded channel bytes held against the limits
+	channels       map[int16]*ChannelImage
+
+	// ChannelData holds the decoded data of each channel by ID. It is nil
+	// until the channels are decoded when parsing with
+	// ParseOptions.LazyChannels.
+	//
+	// Deprecated: ChannelData is replaced without synchronization when the
+	// channels are loaded or released. Use DecodedChannels or Channel.
 	ChannelData map[int16][]byte
 }
 
@@ -44,12 +63,31 @@ type ChannelImage struct {
 	ID          int16
 	Data        []byte
 	Compression uint16
+	decodedSize int64
 }
 
 // ChannelInfo represents channel information in the layer record
 type ChannelInfo struct {
 	ID     int16
-	Length uint32
+	Length uint64 // 8 bytes in PSB; was uint32 before PSB support
+}
+
+// bigLayerInfoKeys lists the additional layer info keys whose length field
+// is 8 bytes wide in PSB documents
+var bigLayerInfoKeys = map[string]bool{
+	"LMsk": true,
+	"Lr16": true,
+	"Lr32": true,
+	"Layr": true,
+	"Mt16": true,
+	"Mt32": true,
+	"Mtrn": true,
+	"Alph": true,
+	"FMsk": true,
+	"lnk2": true,
+	"FEid": true,
+	"FXid": true,
+	"PxSD": true,
 }
 
 // LayerMaskData represents layer mask information for an individual layer
@@ -74,7 +112,7 @@ func (m *LayerMaskData) Height() int32 {
 
 // IsEmpty returns true if the mask has zero dimensions
 func (m *LayerMaskData) IsEmpty() bool {
-	return m.Width() == 0 || m.Height() == 0
+	return m.Width() <= 0 || m.Height() <= 0
 }
 
 // parseRecord parses the layer record (not the channel image data)
@@ -104,6 +142,10 @@ func (l *Layer) parseRecord() error {
 	}
 	l.Right = right
 
+	if err := l.state.limits().checkSize("layer", int64(right)-int64(left), int64(bottom)-int64(top)); err != nil {
+		return err
+	}
+
 	// Read number of channels
 	channels, err := l.file.ReadUint16()
 	if err != nil {
@@ -119,7 +161,7 @@ func (l *Layer) parseRecord() error {
 			return err
 		}
 
-		channelLength, err := l.file.ReadUint32()
+		channelLength, err := l.file.ReadLength(l.header.IsBig())
 		if err != nil {
 			return err
 		}
@@ -130,13 +172,16 @@ func (l *Layer) parseRecord() error {
 		}
 	}
 
-	// Read blend mode signature (should be "8BIM")
+	// Read blend mode signature (should be "8BIM"). The rest of the record
+	// has a fixed layout, so it is read up to the extra data length first to
+	// let lenient parsing skip the record.
 	sig, err := l.file.ReadString(4)
 	if err != nil {
 		return err
 	}
+	var sigErr error
 	if sig != "8BIM" {
-		return fmt.Errorf("invalid blend mode signature: %s", sig)
+		sigErr = fmt.Errorf("invalid blend mode signature: %s", sig)
 	}
 
 	// Read blend mode key
@@ -178,11 +223,17 @@ func (l *Layer) parseRecord() error {
 		return err
 	}
 
+	extraStart, err := l.file.Tell()
+	if err != nil {
+		return err
+	}
+	l.recordEnd = extraStart + int64(extraLen)
+
+	if sigErr != nil {
+		return sigErr
+	}
+
 	if extraLen > 0 {
-		extraStart, err := l.file.Tell()
-		if err != nil {
-			return err
-		}
 
 		// Parse layer mask data
 		if err := l.parseLayerMaskData(); err != nil {
@@ -216,7 +267,9 @@ func (l *Layer) parseRecord() error {
 	// Enhance layer with parsed info (e.g., Unicode name from 'luni')
 	l.EnhanceLayerWithParsedInfo()
 
-	return nil
+	// Continue at the next record whatever the extra data held
+	_, err = l.file.Seek(l.recordEnd, io.SeekStart)
+	return err
 }
 
 func (l *Layer) parseLayerMaskData() error {
@@ -270,6 +323,11 @@ func (l *Layer) parseLayerMaskData() error {
 		return err
 	}
 
+	mask := l.Mask
+	if err := l.state.limits().checkSize("layer mask", int64(mask.Right)-int64(mask.Left), int64(mask.Bottom)-int64(mask.Top)); err != nil {
+		return err
+	}
+
 	// Seek to the end of mask data section to skip any additional data
 	// This matches Ruby's: @file.seek @mask_end
 	_, err = l.file.Seek(maskEnd, 0)
@@ -338,38 +396,61 @@ func (l *Layer) parseAdditionalLayerInfo(length int64) error {
 			break
 		}
 
+		// Anything shorter than a block header is padding
+		if currentPos+12 > endPos {
+			break
+		}
+
 		// Read signature
+		blockPos := currentPos
 		sig, err := l.file.ReadString(4)
 		if err != nil {
-			break
+			return err
 		}
 		if sig != "8BIM" && sig != "8B64" {
+			// The remaining blocks cannot be located, but the record end is
+			// known, so parsing goes on with the next record. Lenient
+			// parsing reports the skipped blocks as a warning.
+			l.state.recover(l.parseError("", blockPos, fmt.Errorf("invalid layer info signature: %q", sig)))
 			break
 		}
 
 		// Read key
 		key, err := l.file.ReadString(4)
 		if err != nil {
-			break
+			return err
 		}
 
-		// Read length
-		dataLen, err := l.file.ReadUint32()
+		// Read length (8 bytes for some keys in PSB)
+		dataLen, err := l.file.ReadLength(l.header.IsBig() && (sig == "8B64" || bigLayerInfoKeys[key]))
 		if err != nil {
-			break
+			return err
 		}
 
 		// Read data
 		if dataLen > 0 {
-			data := make([]byte, dataLen)
-			if _, err := l.file.Read(data); err != nil {
-				break
+			if err := l.state.limits().checkResource(fmt.Sprintf("layer info %q", key), dataLen); err != nil {
+				return l.parseError(key, blockPos, err)
+			}
+			data, err := l.file.ReadBytes(dataLen)
+			if err != nil {
+				err = l.parseError(key, blockPos, fmt.Errorf("failed to read layer info: %w", err))
+				if l.state.recover(err) {
+					break
+				}
+				return err
 			}
 			l.LayerInfo[key] = data
 
-			// Parse TypeTool if this is a text layer
+			// Parse TypeTool if this is a text layer. Only a descriptor
+			// over the limits fails the record.
 			if key == "TySh" {
-				if typeTool, err := ParseTypeTool(data); err == nil {
+				typeTool, err := parseTypeTool(data, l.state.limits())
+				if errors.Is(err, ErrLimitExceeded) {
+					if err := l.parseError(key, blockPos, err); !l.state.recover(err) {
+						return err
+					}
+				} else if err == nil {
 					l.TypeTool = typeTool
 				}
 			}
@@ -392,97 +473,313 @@ func (l *Layer) parseAdditionalLayerInfo(length int64) error {
 	return nil
 }
 
-func (l *Layer) parseChannelData() error {
-	l.channels = make(map[int16]*ChannelImage)
-	l.ChannelData = make(map[int16][]byte)
+// readChannelData reads the layer's channel data in file order and returns
+// the channels left to decode. Channels are not read with LazyChannels.
+func (l *Layer) readChannelData(ctx context.Context) ([]*channelJob, error) {
+	endPos, err := l.locateChannels()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, chanInfo := range l.ChannelInfo {
-		// Record file position at start of this channel
-		startPos, err := l.file.Tell()
-		if err != nil {
-			return fmt.Errorf("failed to get file position for channel %d: %w", chanInfo.ID, err)
+	var jobs []*channelJob
+	if !l.state.lazyChannels() {
+		jobs = l.readChannels(ctx)
+	}
+
+	// Continue after the last channel whatever was read
+	if _, err := l.file.Seek(endPos, io.SeekStart); err != nil {
+		releaseChannelJobs(jobs)
+		return nil, fmt.Errorf("failed to seek past channel data: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// skipChannelData moves past the layer's channel data without decoding it
+func (l *Layer) skipChannelData() error {
+	endPos, err := l.locateChannels()
+	if err != nil {
+		return err
+	}
+	l.channelOffsets = nil
+
+	_, err = l.file.Seek(endPos, io.SeekStart)
+	return err
+}
+
+// locateChannels records where each channel's data starts; channels are
+// stored back to back. It returns the end of the layer's channel data.
+func (l *Layer) locateChannels() (int64, error) {
+	startPos, err := l.file.Tell()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file position for channel data: %w", err)
+	}
+
+	l.channelOffsets = make([]int64, len(l.ChannelInfo))
+	endPos := startPos
+	for i, chanInfo := range l.ChannelInfo {
+		l.channelOffsets[i] = endPos
+		endPos += int64(chanInfo.Length)
+	}
+
+	return endPos, nil
+}
+
+// LoadChannels decodes the layer's channel image data if it has not been
+// decoded yet. Layers parsed with ParseOptions.LazyChannels are decoded on
+// first use by ToImage, Channel and the renderer. It may be called from
+// several goroutines; the channels are decoded once.
+func (l *Layer) LoadChannels() error {
+	_, err := l.loadChannels(context.Background())
+	return err
+}
+
+// loadChannels decodes the layer's channels, stopping when ctx is done, and
+// returns them. The returned map stays valid after ReleaseChannels.
+func (l *Layer) loadChannels(ctx context.Context) (map[int16]*ChannelImage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.channels != nil {
+		return l.channels, nil
+	}
+
+	jobs := l.readChannels(ctx)
+	decodeChannelJobs(ctx, l.state, jobs)
+	if err := l.finishChannels(jobs); err != nil {
+		return nil, err
+	}
+	return l.channels, nil
+}
+
+// channelJob is a channel read from the document and waiting to be decoded.
+// Reading goes through the File and is serial; decoding only touches the job
+// and may run on any goroutine.
+type channelJob struct {
+	layer       *Layer
+	info        ChannelInfo
+	offset      int64
+	compression uint16
+	compressed  []byte
+	size        int64 // decoded bytes reserved against the limits
+	channel     *ChannelImage
+	err         error
+}
+
+// readChannels reads the compressed data of every channel. A channel that
+// cannot be read keeps its error; in strict mode, or once ctx is done,
+// reading stops there.
+func (l *Layer) readChannels(ctx context.Context) []*channelJob {
+	jobs := make([]*channelJob, 0, len(l.ChannelInfo))
+	for i, chanInfo := range l.ChannelInfo {
+		if i >= len(l.channelOffsets) {
+			break
 		}
 
-		// If channel has no data (length <= 2 means only compression header or nothing),
-		// we still need to read/skip the bytes to keep file pointer aligned
-		if chanInfo.Length <= 2 {
-			if chanInfo.Length > 0 {
-				// Seek past the channel data (usually just the 2-byte compression header)
-				if err := l.file.Skip(int64(chanInfo.Length)); err != nil {
-					return fmt.Errorf("failed to skip channel %d: %w", chanInfo.ID, err)
-				}
+		job := &channelJob{layer: l, info: chanInfo, offset: l.channelOffsets[i]}
+		if err := ctx.Err(); err != nil {
+			job.err = err
+			jobs = append(jobs, job)
+			break
+		}
+		if err := job.read(); err != nil {
+			job.err = l.parseError("", job.offset, err)
+			jobs = append(jobs, job)
+			if !l.state.lenient() {
+				break
 			}
 			continue
 		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
 
-		// Read compression method
-		compression, err := l.file.ReadUint16()
-		if err != nil {
-			return fmt.Errorf("failed to read compression for channel %d (length=%d): %w", chanInfo.ID, chanInfo.Length, err)
+// finishChannels stores the decoded channels of jobs in channel order. In
+// lenient mode damaged channels are left out; otherwise the first error is
+// returned and every reserved byte is released.
+func (l *Layer) finishChannels(jobs []*channelJob) error {
+	channels := make(map[int16]*ChannelImage)
+	channelData := make(map[int16][]byte)
+	var decoded int64
+
+	for i, job := range jobs {
+		if job.err != nil {
+			if l.state.recover(job.err) {
+				// Leave the damaged channel out
+				continue
+			}
+			l.state.release(decoded)
+			releaseChannelJobs(jobs[i+1:])
+			return job.err
+		}
+		if ch := job.channel; ch != nil {
+			channels[ch.ID] = ch
+			channelData[ch.ID] = ch.Data
+			decoded += ch.decodedSize
 		}
+	}
 
-		dataLength := chanInfo.Length - 2
+	l.channels = channels
+	l.ChannelData = channelData
+	l.decodedBytes = decoded
+	return nil
+}
 
-		switch compression {
-		case 0: // Raw data
-			data := make([]byte, dataLength)
-			if _, err := l.file.Read(data); err != nil {
-				return fmt.Errorf("failed to read raw data for channel %d: %w", chanInfo.ID, err)
-			}
-			l.ChannelData[chanInfo.ID] = data
-			l.channels[chanInfo.ID] = &ChannelImage{
-				ID:          chanInfo.ID,
-				Data:        data,
-				Compression: compression,
-			}
+// parseError attributes err to this layer
+func (l *Layer) parseError(key string, offset int64, err error) error {
+	return newParseError(SectionLayers, l.index, key, offset, err)
+}
 
-		case 1: // RLE compression
-			// Read RLE compressed data
-			compressedData := make([]byte, dataLength)
-			if _, err := l.file.Read(compressedData); err != nil {
-				return fmt.Errorf("failed to read RLE data for channel %d: %w", chanInfo.ID, err)
-			}
+// ReleaseChannels drops the decoded channel image data. It is decoded again
+// from the document on next use, so the PSD must remain open. Images already
+// returned by ToImage or Channel are not affected.
+func (l *Layer) ReleaseChannels() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state.release(l.decodedBytes)
+	l.decodedBytes = 0
+	l.channels = nil
+	l.ChannelData = nil
+}
 
-			// Decompress RLE
-			decompressed, err := l.decompressRLE(compressedData, chanInfo.ID)
-			if err != nil {
-				return fmt.Errorf("failed to decompress RLE for channel %d: %w", chanInfo.ID, err)
-			}
+// DecodedChannels returns the decoded data of the layer's channels by ID,
+// or nil if they have not been decoded or were released. It is safe for
+// concurrent use; the returned map must not be modified.
+func (l *Layer) DecodedChannels() map[int16][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ChannelData
+}
 
-			l.ChannelData[chanInfo.ID] = decompressed
-			l.channels[chanInfo.ID] = &ChannelImage{
-				ID:          chanInfo.ID,
-				Data:        decompressed,
-				Compression: compression,
-			}
+// Channel returns the decoded image data of a channel, decoding the layer's
+// channels first if needed. It returns nil if the layer has no such channel.
+func (l *Layer) Channel(id int16) ([]byte, error) {
+	channels, err := l.loadChannels(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if ch, exists := channels[id]; exists {
+		return ch.Data, nil
+	}
+	return nil, nil
+}
 
+// read reads the channel's compression method and data and reserves its
+// decoded size. Channels without image data are left empty.
+func (j *channelJob) read() error {
+	l := j.layer
 
-		default:
-			// Skip unknown compression
-			if err := l.file.Skip(int64(dataLength)); err != nil {
-				return fmt.Errorf("failed to skip unknown compression %d for channel %d: %w", compression, chanInfo.ID, err)
-			}
-		}
+	// If channel has no data (length <= 2 means only compression header or nothing),
+	// there is nothing to decode
+	if j.info.Length <= 2 {
+		return nil
+	}
+
+	// Channels are read with positional reads, so layers can be decoded
+	// from several goroutines
+	var marker [2]byte
+	if _, err := l.file.ReadAt(marker[:], j.offset); err != nil {
+		return fmt.Errorf("failed to read compression for channel %d (length=%d): %w", j.info.ID, j.info.Length, err)
+	}
+	compression := binary.BigEndian.Uint16(marker[:])
 
-		// Verify we read the correct number of bytes
-		// This is CRITICAL - if we didn't read exactly chanInfo.Length bytes,
-		// we need to seek to the correct position for the next channel
-		finishPos, err := l.file.Tell()
+	if compression > CompressionZIPPrediction {
+		return fmt.Errorf("%w: method %d for channel %d", ErrUnsupportedCompression, compression, j.info.ID)
+	}
+
+	// Check the length against the file size before allocating
+	dataPos := j.offset + 2
+	if j.info.Length-2 > uint64(max(l.file.Size()-dataPos, 0)) {
+		return fmt.Errorf("failed to read data for channel %d: %w", j.info.ID, errTruncatedRead)
+	}
+	compressedData := make([]byte, j.info.Length-2)
+	if _, err := l.file.ReadAt(compressedData, dataPos); err != nil {
+		return fmt.Errorf("failed to read data for channel %d: %w", j.info.ID, err)
+	}
+
+	width, height := l.channelSize(j.info.ID)
+	size := int64(l.header.BytesPerRow(width)) * int64(height)
+	if compression == CompressionRaw {
+		size = int64(len(compressedData))
+	}
+	if err := l.state.reserve(size); err != nil {
+		return fmt.Errorf("failed to decode channel %d: %w", j.info.ID, err)
+	}
+
+	j.compression = compression
+	j.compressed = compressedData
+	j.size = size
+	return nil
+}
+
+// decode decompresses the channel read by read. On error the reserved bytes
+// are released.
+func (j *channelJob) decode(ctx context.Context) {
+	if j.err != nil || j.compressed == nil {
+		return
+	}
+
+	data, err := j.decompress(ctx)
+	j.compressed = nil
+	if err != nil {
+		j.layer.state.release(j.size)
+		j.size = 0
+		j.err = j.layer.parseError("", j.offset, err)
+		return
+	}
+
+	j.channel = &ChannelImage{
+		ID:          j.info.ID,
+		Data:        data,
+		Compression: j.compression,
+		decodedSize: j.size,
+	}
+}
+
+// decompress decodes the channel's compressed data
+func (j *channelJob) decompress(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l := j.layer
+
+	switch j.compression {
+	case CompressionRLE:
+		data, err := l.decompressRLE(ctx, j.compressed, j.info.ID)
 		if err != nil {
-			return fmt.Errorf("failed to get file position after channel %d: %w", chanInfo.ID, err)
+			return nil, fmt.Errorf("failed to decompress RLE for channel %d: %w", j.info.ID, err)
 		}
+		return data, nil
 
-		expectedPos := startPos + int64(chanInfo.Length)
-
-		if finishPos != expectedPos {
-			_, err := l.file.Seek(expectedPos, 0)
-			if err != nil {
-				return fmt.Errorf("failed to seek to correct position after channel %d: %w", chanInfo.ID, err)
-			}
+	case CompressionZIP, CompressionZIPPrediction:
+		width, _ := l.channelSize(j.info.ID)
+		data, err := decompressZIP(j.compressed, int(j.size), l.header.BytesPerRow(width), l.header.Depth, j.compression == CompressionZIPPrediction)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress ZIP for channel %d: %w", j.info.ID, err)
 		}
+		return data, nil
 	}
 
-	return nil
+	return j.compressed, nil
+}
+
+// decodeChannelJobs decodes jobs with up to the configured number of
+// goroutines
+func decodeChannelJobs(ctx context.Context, state *parseState, jobs []*channelJob) {
+	forEach(state.concurrency(), len(jobs), func(i int) {
+		jobs[i].decode(ctx)
+	})
+}
+
+// releaseChannelJobs returns the bytes reserved by jobs that will not be
+// stored
+func releaseChannelJobs(jobs []*channelJob) {
+	for _, job := range jobs {
+		job.layer.state.release(job.size)
+		job.size = 0
+	}
 }
 
 // Width returns the width of the layer
@@ -593,33 +890,50 @@ type BlendMode struct {
 	Visible           bool
 }
 
-// decompressRLE decompresses RLE compressed channel data
-func (l *Layer) decompressRLE(compressedData []byte, channelID int16) ([]byte, error) {
+// channelSize returns the pixel dimensions of a channel
+func (l *Layer) channelSize(channelID int16) (width, height int) {
 	// CRITICAL FIX: Match Ruby's channel_image.rb logic
 	// When channel ID < -1 (mask channel -2), use mask dimensions
 	// Otherwise use layer dimensions
-	var width, height int
 	if channelID < -1 && l.Mask != nil {
 		// Mask channel - use mask dimensions
-		width = int(l.Mask.Width())
-		height = int(l.Mask.Height())
+		width, height = int(l.Mask.Width()), int(l.Mask.Height())
 	} else {
 		// Regular channels - use layer dimensions
-		width = int(l.Width())
-		height = int(l.Height())
+		width, height = int(l.Width()), int(l.Height())
 	}
+	// Inverted rectangles hold no pixels
+	if width < 0 || height < 0 {
+		return 0, 0
+	}
+	return width, height
+}
+
+// decompressRLE decompresses RLE compressed channel data, stopping between
+// scanlines when ctx is done
+func (l *Layer) decompressRLE(ctx context.Context, compressedData []byte, channelID int16) ([]byte, error) {
+	width, height := l.channelSize(channelID)
 
-	if width == 0 || height == 0 {
+	if width <= 0 || height <= 0 {
 		return []byte{}, nil
 	}
 
+	// Scanlines hold depth/8 bytes per sample
+	width = l.header.BytesPerRow(width)
+
 	// The first part contains byte counts for each scanline
-	byteCounts := make([]uint16, height)
+	// (2 bytes each in PSD, 4 bytes each in PSB)
+	countSize := l.header.RLECountSize()
+	byteCounts := make([]uint32, height)
 	offset := 0
 
-	for i := 0; i < height && offset+1 < len(compressedData); i++ {
-		byteCounts[i] = uint16(compressedData[offset])<<8 | uint16(compressedData[offset+1])
-		offset += 2
+	for i := 0; i < height && offset+countSize <= len(compressedData); i++ {
+		if countSize == 4 {
+			byteCounts[i] = binary.BigEndian.Uint32(compressedData[offset:])
+		} else {
+			byteCounts[i] = uint32(binary.BigEndian.Uint16(compressedData[offset:]))
+		}
+		offset += countSize
 	}
 
 	// Decompress the RLE data
@@ -627,6 +941,10 @@ func (l *Layer) decompressRLE(compressedData []byte, channelID int16) ([]byte, e
 	pos := 0
 
 	for row := 0; row < height; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		byteCount := int(byteCounts[row])
 		if byteCount == 0 {
 			// Empty scanline
@@ -686,7 +1004,7 @@ func (l *Layer) ToImage() (*image.RGBA, error) {
 	width := int(l.Width())
 	height := int(l.Height())
 
-	if width == 0 || height == 0 {
+	if width <= 0 || height <= 0 {
 		return nil, nil
 	}
 
@@ -698,55 +1016,102 @@ func (l *Layer) ToImage() (*image.RGBA, error) {
 		return img, nil
 	}
 
+	channels, err := l.loadChannels(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return l.toImage(channels), nil
+}
+
+// toImage converts the given decoded channels of the layer to an image,
+// like ToImage
+func (l *Layer) toImage(channels map[int16]*ChannelImage) *image.RGBA {
+	width := int(l.Width())
+	height := int(l.Height())
+
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
 	// Create image
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if l.Mask != nil && l.Mask.IsEmpty() {
+		return img
+	}
 
-	// Channel IDs: -2 = layer mask, -1 = transparency, 0 = red, 1 = green, 2 = blue
-	var rData, gData, bData, aData []byte
-
-	// Get channel data (mask data is now handled in renderer)
-	if ch, exists := l.channels[-1]; exists {
-		aData = ch.Data
+	// Fill image with pixel data, down-converted to 8 bits per channel
+	// NOTE: Mask is NOT applied here - it will be applied in renderer
+	// This matches Ruby's architecture where mask is applied in Canvas.paint_to()
+	// not in the layer image extraction phase
+	pc := l.converter(channels)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, pc.rgba8(y*width+x))
+		}
 	}
-	if ch, exists := l.channels[0]; exists {
-		rData = ch.Data
+
+	return img
+}
+
+// ToImage64 converts the layer to an image.NRGBA64, preserving the
+// precision of 16 and 32-bit documents. Like ToImage, the layer mask is not
+// applied.
+func (l *Layer) ToImage64() (*image.NRGBA64, error) {
+	width := int(l.Width())
+	height := int(l.Height())
+
+	if width <= 0 || height <= 0 {
+		return nil, nil
 	}
-	if ch, exists := l.channels[1]; exists {
-		gData = ch.Data
+
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	if l.Mask != nil && l.Mask.IsEmpty() {
+		return img, nil
 	}
-	if ch, exists := l.channels[2]; exists {
-		bData = ch.Data
+
+	channels, err := l.loadChannels(context.Background())
+	if err != nil {
+		return nil, err
 	}
 
-	// Fill image with pixel data
+	pc := l.converter(channels)
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			idx := y*width + x
+			img.SetNRGBA64(x, y, pc.nrgba64(y*width+x))
+		}
+	}
 
-			var r, g, b, a uint8 = 0, 0, 0, 255
+	return img, nil
+}
 
-			if rData != nil && idx < len(rData) {
-				r = rData[idx]
-			}
-			if gData != nil && idx < len(gData) {
-				g = gData[idx]
+// converter returns a pixel converter over the layer's decoded channels
+// Channel IDs: -2 = layer mask, -1 = transparency, 0.. = colour channels
+// in the document's colour mode (e.g. red, green, blue or gray or L, a, b)
+func (l *Layer) converter(channels map[int16]*ChannelImage) *pixelConverter {
+	colorChannels := l.header.ColorChannels()
+	if l.header.IsMultichannel() {
+		colorChannels = 0
+		for _, info := range l.ChannelInfo {
+			if int(info.ID) >= colorChannels {
+				colorChannels = int(info.ID) + 1
 			}
-			if bData != nil && idx < len(bData) {
-				b = bData[idx]
-			}
-			if aData != nil && idx < len(aData) {
-				a = aData[idx]
-			}
-
-			// NOTE: Mask is NOT applied here - it will be applied in renderer
-			// This matches Ruby's architecture where mask is applied in Canvas.paint_to()
-			// not in the layer image extraction phase
+		}
+	}
 
-			img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: a})
+	planes := make([][]byte, colorChannels)
+	for i := range planes {
+		if ch, exists := channels[int16(i)]; exists {
+			planes[i] = ch.Data
 		}
 	}
 
-	return img, nil
+	var alpha []byte
+	if ch, exists := channels[-1]; exists {
+		alpha = ch.Data
+	}
+
+	return newPixelConverter(l.header, l.colors, int(l.Width()), planes, alpha)
 }
 
 // FillOpacity returns the layer's fill opacity (0-255)
@@ -0,0 +1,477 @@
+package psd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// resourceLayerComps is the ID of the layer comps resource
+const resourceLayerComps = 1065
+
+// Captured info flags of a layer comp: the layer properties it restores
+const (
+	LayerCompVisibility uint32 = 1
+	LayerCompPosition   uint32 = 2
+	LayerCompAppearance uint32 = 4 // Blend mode, opacities and layer style state
+)
+
+// LayerComp represents a layer comp
+type LayerComp struct {
+	ID           int
+	Name         string
+	Comment      string
+	CapturedInfo uint32
+}
+
+// CapturesVisibility returns whether the comp restores layer visibility
+func (c LayerComp) CapturesVisibility() bool {
+	return c.CapturedInfo&LayerCompVisibility != 0
+}
+
+// CapturesPosition returns whether the comp restores layer positions
+func (c LayerComp) CapturesPosition() bool {
+	return c.CapturedInfo&LayerCompPosition != 0
+}
+
+// CapturesAppearance returns whether the comp restores layer blend modes and
+// opacities
+func (c LayerComp) CapturesAppearance() bool {
+	return c.CapturedInfo&LayerCompAppearance != 0
+}
+
+// LayerCompsResource represents the layer comps resource (ID 1065)
+type LayerCompsResource struct {
+	LastApplied int // ID of the comp applied last, 0 if none
+	Comps       []LayerComp
+}
+
+// ParseLayerComps parses the layer comps resource (ID 1065)
+func (r *ResourceSection) ParseLayerComps() (*LayerCompsResource, error) {
+	data := r.resourceData(resourceLayerComps)
+	if len(data) == 0 {
+		return &LayerCompsResource{Comps: []LayerComp{}}, nil
+	}
+	return parseLayerComps(data, r.state.limits())
+}
+
+func parseLayerComps(data []byte, limits Limits) (*LayerCompsResource, error) {
+	desc, err := parseVersionedDescriptor(data, limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse layer comps: %w", err)
+	}
+
+	result := &LayerCompsResource{Comps: []LayerComp{}}
+	if id, ok := desc["lastAppliedComp"].(int32); ok {
+		result.LastApplied = int(id)
+	}
+	list, _ := desc["list"].([]interface{})
+	for _, item := range list {
+		compData, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		comp := LayerComp{}
+		if id, ok := compData["compID"].(int32); ok {
+			comp.ID = int(id)
+		}
+		if name, ok := compData["Nm  "].(string); ok {
+			comp.Name = strings.TrimRight(name, "\x00")
+		}
+		if comment, ok := compData["comment"].(string); ok {
+			comp.Comment = strings.TrimRight(comment, "\x00")
+		}
+		if info, ok := compData["capturedInfo"].(int32); ok {
+			comp.CapturedInfo = uint32(info)
+		}
+		result.Comps = append(result.Comps, comp)
+	}
+	return result, nil
+}
+
+// parseVersionedDescriptor parses a descriptor preceded by its version (16)
+func parseVersionedDescriptor(data []byte, limits Limits) (map[string]interface{}, error) {
+	if len(data) < 4 {
+		return nil, errTruncatedRead
+	}
+	if version := binary.BigEndian.Uint32(data); version != 16 {
+		return nil, fmt.Errorf("unsupported descriptor version: %d", version)
+	}
+	return NewDescriptorParserWithLimits(data[4:], limits).Parse()
+}
+
+// LayerComps returns the layer comps (ID 1065), or an empty slice if they
+// cannot be parsed
+func (r *ResourceSection) LayerComps() []LayerComp {
+	comps, err := r.ParseLayerComps()
+	if err != nil {
+		return []LayerComp{}
+	}
+	return comps.Comps
+}
+
+// LayerCompSetting is the state of a layer in the comps listed in CompIDs.
+// Photoshop stores the settings of a layer as a chain of changes: nil
+// fields keep the value of the previous setting, or of the layer itself for
+// the first one.
+type LayerCompSetting struct {
+	CompIDs        []int
+	Visible        *bool
+	Position       *image.Point // Document position of the layer's top left corner
+	BlendMode      string       // Blend mode name as in Node.BlendMode, empty if unchanged
+	Opacity        *uint8
+	FillOpacity    *uint8
+	EffectsVisible *bool        // Whether the layer style is shown
+	FXRefPoint     *image.Point // Reference point of the layer style, such as a pattern origin
+}
+
+// LayerCompState is the state of a layer in a layer comp
+type LayerCompState struct {
+	Visible        bool
+	Left           int32
+	Top            int32
+	BlendMode      string
+	Opacity        uint8
+	FillOpacity    uint8
+	EffectsVisible bool
+	FXRefPoint     image.Point
+}
+
+// LayerCompSettings parses the layer's per-comp settings from the 'cmls'
+// entry of its metadata ('shmd'). It returns nil if the layer has none.
+func (l *Layer) LayerCompSettings() ([]LayerCompSetting, error) {
+	desc, err := l.layerCompSettings()
+	if desc == nil || err != nil {
+		return nil, err
+	}
+	return parseLayerCompSettings(desc), nil
+}
+
+func parseLayerCompSettings(desc map[string]interface{}) []LayerCompSetting {
+	list, _ := desc["layerSettings"].([]interface{})
+	settings := make([]LayerCompSetting, 0, len(list))
+	for _, item := range list {
+		settingData, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		settings = append(settings, parseLayerCompSetting(settingData))
+	}
+	return settings
+}
+
+// layerCompSettings parses the 'cmls' descriptor of the layer, or returns
+// nil if it has none
+func (l *Layer) layerCompSettings() (map[string]interface{}, error) {
+	metadata, err := parseLayerMetadata(l.LayerInfo["shmd"])
+	if err != nil {
+		return nil, err
+	}
+	data, ok := metadata["cmls"]
+	if !ok {
+		return nil, nil
+	}
+	desc, err := parseVersionedDescriptor(data, l.state.limits())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse layer comp settings: %w", err)
+	}
+	return desc, nil
+}
+
+// descriptorPoint returns a descriptor holding 'Hrzn' and 'Vrtc' as a point
+func descriptorPoint(value interface{}) (*image.Point, bool) {
+	desc, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	x, xOK := descriptorNumber(desc["Hrzn"])
+	y, yOK := descriptorNumber(desc["Vrtc"])
+	if !xOK || !yOK {
+		return nil, false
+	}
+	return &image.Point{X: int(x), Y: int(y)}, true
+}
+
+func parseLayerCompSetting(data map[string]interface{}) LayerCompSetting {
+	setting := LayerCompSetting{}
+	ids, _ := data["compList"].([]interface{})
+	for _, id := range ids {
+		if id, ok := id.(int32); ok {
+			setting.CompIDs = append(setting.CompIDs, int(id))
+		}
+	}
+
+	if enabled, ok := data["enab"].(bool); ok {
+		setting.Visible = &enabled
+	}
+	if position, ok := descriptorPoint(data["Ofst"]); ok {
+		setting.Position = position
+	}
+	if visible, ok := data["layerFXVisible"].(bool); ok {
+		setting.EffectsVisible = &visible
+	}
+	if point, ok := descriptorPoint(data["FXRefPoint"]); ok {
+		setting.FXRefPoint = point
+	}
+	if options, ok := data["blendOptions"].(map[string]interface{}); ok {
+		if mode, ok := options["Md  "].(map[string]interface{}); ok {
+			if value, ok := mode["value"].(string); ok {
+				setting.BlendMode = blendModeName(value)
+			}
+		}
+		if opacity, ok := descriptorPercent(options["Opct"]); ok {
+			setting.Opacity = &opacity
+		}
+		if fill, ok := descriptorPercent(options["FlOp"]); ok {
+			setting.FillOpacity = &fill
+		}
+	}
+	return setting
+}
+
+// descriptorNumber returns an integer, double or unit value as a float64
+func descriptorNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case map[string]interface{}:
+		if f, ok := v["value"].(float64); ok {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// descriptorPercent converts a percentage to 0...255
+func descriptorPercent(value interface{}) (uint8, bool) {
+	percent, ok := descriptorNumber(value)
+	if !ok {
+		return 0, false
+	}
+	return uint8(max(0, min(255, percent*255/100+0.5))), true
+}
+
+// blendModeNames maps descriptor blend modes whose names differ from
+// Node.BlendMode
+var blendModeNames = map[string]string{
+	"passThrough":      "pass",
+	"blendSubtraction": "subtract",
+	"blendDivide":      "divide",
+}
+
+// blendModeName converts a descriptor blend mode such as "colorBurn" to the
+// name used by Node.BlendMode, "color_burn"
+func blendModeName(mode string) string {
+	if name, ok := blendModeNames[mode]; ok {
+		return name
+	}
+	var name strings.Builder
+	for _, r := range mode {
+		if r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		name.WriteRune(r)
+	}
+	return name.String()
+}
+
+// parseLayerMetadata parses the metadata setting ('shmd') of a layer into
+// its entries by key, such as 'cmls' for layer comps and 'cust' for
+// timestamps
+func parseLayerMetadata(data []byte) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	if len(data) == 0 {
+		return entries, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("layer metadata: %w", errTruncatedRead)
+	}
+	count := binary.BigEndian.Uint32(data)
+	pos := 4
+	for i := uint32(0); i < count; i++ {
+		// Signature, key, copy on sheet duplication flag, padding and length
+		if pos+16 > len(data) {
+			return nil, fmt.Errorf("layer metadata entry %d: %w", i, errTruncatedRead)
+		}
+		key := string(data[pos+4 : pos+8])
+		length := uint64(binary.BigEndian.Uint32(data[pos+12:]))
+		pos += 16
+		if length > uint64(len(data)-pos) {
+			return nil, fmt.Errorf("layer metadata %q: %w", key, errTruncatedRead)
+		}
+		entries[key] = data[pos : pos+int(length)]
+		pos += int(length)
+	}
+	return entries, nil
+}
+
+// CompState returns the state of the layer in comp. Layers without settings
+// for the comp keep their own state.
+func (l *Layer) CompState(comp LayerComp) (LayerCompState, error) {
+	initial := LayerCompState{
+		Visible:     l.Visible(),
+		Left:        l.Left,
+		Top:         l.Top,
+		BlendMode:   l.blendModeString(),
+		Opacity:     l.Opacity,
+		FillOpacity: l.FillOpacity(),
+		// Layer effects are not parsed, so they are taken to be shown
+		EffectsVisible: true,
+	}
+	desc, err := l.layerCompSettings()
+	if err != nil {
+		return initial, err
+	}
+	if point, ok := descriptorPoint(desc["origFXRefPoint"]); ok {
+		initial.FXRefPoint = *point
+	}
+	settings := parseLayerCompSettings(desc)
+
+	state := initial
+	for _, setting := range settings {
+		if setting.Visible != nil {
+			state.Visible = *setting.Visible
+		}
+		if setting.Position != nil {
+			state.Left, state.Top = int32(setting.Position.X), int32(setting.Position.Y)
+		}
+		if setting.BlendMode != "" {
+			state.BlendMode = setting.BlendMode
+		}
+		if setting.Opacity != nil {
+			state.Opacity = *setting.Opacity
+		}
+		if setting.FillOpacity != nil {
+			state.FillOpacity = *setting.FillOpacity
+		}
+		if setting.EffectsVisible != nil {
+			state.EffectsVisible = *setting.EffectsVisible
+		}
+		if setting.FXRefPoint != nil {
+			state.FXRefPoint = *setting.FXRefPoint
+		}
+		for _, id := range setting.CompIDs {
+			if id == comp.ID {
+				return state, nil
+			}
+		}
+	}
+	return initial, nil
+}
+
+// FilterByComp returns a copy of the tree with the layer comp named
+// compName applied. See FilterByLayerComp.
+func (n *Node) FilterByComp(compName string) (*Node, error) {
+	root := n.Root()
+	if root.psd != nil {
+		for _, comp := range root.psd.LayerComps() {
+			if comp.Name == compName {
+				return n.FilterByLayerComp(comp)
+			}
+		}
+	}
+	return nil, fmt.Errorf("layer comp not found: %q", compName)
+}
+
+// FilterByLayerComp returns a copy of the subtree rooted at n with the
+// visibility, position and appearance captured by comp applied to its
+// layers and groups, ready to be rendered. Appearance includes whether the
+// layer style is shown, reported by Node.EffectsVisible; the renderer does
+// not draw layer effects, so it does not change the rendered image. The
+// nodes share their layers, and so their pixel data, with n; the original
+// tree is not modified.
+func (n *Node) FilterByLayerComp(comp LayerComp) (*Node, error) {
+	filtered := n.clone(nil)
+	for _, node := range filtered.Subtree() {
+		if node.Layer == nil {
+			continue
+		}
+		state, err := node.Layer.CompState(comp)
+		if err != nil {
+			return nil, fmt.Errorf("layer %q: %w", node.Name, err)
+		}
+		if comp.CapturesVisibility() {
+			node.Visible = state.Visible
+		}
+		if comp.CapturesPosition() && node.Type == NodeTypeLayer {
+			dx, dy := state.Left-node.Left, state.Top-node.Top
+			node.Left += dx
+			node.Right += dx
+			node.Top += dy
+			node.Bottom += dy
+		}
+		if comp.CapturesAppearance() {
+			node.BlendMode = state.BlendMode
+			node.Opacity = state.Opacity
+			fillOpacity := state.FillOpacity
+			node.fillOpacity = &fillOpacity
+			effectsVisible := state.EffectsVisible
+			node.effectsVisible = &effectsVisible
+		}
+	}
+	filtered.UpdateDimensions()
+	return filtered, nil
+}
+
+// clone returns a deep copy of the subtree rooted at n, sharing its layers
+func (n *Node) clone(parent *Node) *Node {
+	c := new(Node)
+	*c = *n
+	c.Parent = parent
+	c.Children = make([]*Node, len(n.Children))
+	for i, child := range n.Children {
+		c.Children[i] = child.clone(c)
+	}
+	return c
+}
+
+// RenderComps renders the document once per layer comp, in the order of
+// resource 1065, and calls fn with each comp and its image. Layer pixels are
+// decoded and converted once and shared by every comp. Rendering stops at
+// the first error, including one returned by fn.
+func (p *PSD) RenderComps(fn func(comp LayerComp, img image.Image) error) error {
+	return p.RenderCompsContext(context.Background(), fn)
+}
+
+// RenderCompsContext renders like RenderComps, stopping when ctx is done
+func (p *PSD) RenderCompsContext(ctx context.Context, fn func(comp LayerComp, img image.Image) error) error {
+	resources, err := p.parseResources(ctx)
+	if err != nil {
+		return err
+	}
+	comps, err := resources.ParseLayerComps()
+	if err != nil {
+		return err
+	}
+	if len(comps.Comps) == 0 {
+		return nil
+	}
+
+	layerMask, err := p.parseLayerMask(ctx)
+	if err != nil {
+		return err
+	}
+	tree := layerMask.Tree()
+	layerImages := make(map[*Layer]*image.RGBA)
+	for _, comp := range comps.Comps {
+		filtered, err := tree.FilterByLayerComp(comp)
+		if err != nil {
+			return fmt.Errorf("layer comp %q: %w", comp.Name, err)
+		}
+		renderer := NewRenderer(filtered)
+		renderer.layerImages = layerImages
+		img, err := renderer.RenderContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to render layer comp %q: %w", comp.Name, err)
+		}
+		if err := fn(comp, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package psd
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerComps(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	comps := psd.LayerComps()
+	require.Len(t, comps, 3)
+	assert.Equal(t, LayerComp{ID: 692243163, Name: "Version A", CapturedInfo: LayerCompVisibility}, comps[0])
+	assert.Equal(t, "Version B", comps[1].Name)
+	assert.Equal(t, "Version C", comps[2].Name)
+	assert.True(t, comps[0].CapturesVisibility())
+
+	// Layer style reference points, in every comp and by default
+	glyph := psd.Tree().ChildrenAtPath("Version A/Logo_Glyph")[0].Layer
+	state, err := glyph.CompState(comps[1])
+	require.NoError(t, err)
+	assert.Equal(t, image.Point{X: -66, Y: 82}, state.FXRefPoint)
+	assert.True(t, state.EffectsVisible)
+	assert.False(t, comps[0].CapturesPosition())
+
+	resource, err := psd.Resources().ParseLayerComps()
+	require.NoError(t, err)
+	assert.Equal(t, 692243163, resource.LastApplied)
+
+	decoded, err := psd.Resources().Decode(1065)
+	require.NoError(t, err)
+	assert.Equal(t, resource, decoded)
+}
+
+func TestFilterByComp(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	tree := psd.Tree()
+
+	visibleGroups := func(root *Node) []string {
+		var names []string
+		for _, group := range root.Children {
+			if group.Visible {
+				names = append(names, group.Name)
+			}
+		}
+		return names
+	}
+	require.Equal(t, []string{"Version A"}, visibleGroups(tree))
+
+	for _, name := range []string{"Version A", "Version B", "Version C"} {
+		filtered, err := tree.FilterByComp(name)
+		require.NoError(t, err)
+		assert.Equal(t, []string{name}, visibleGroups(filtered))
+		assert.Equal(t, tree.Width(), filtered.Width())
+	}
+
+	// Comps render through the existing renderer
+	a, err := tree.FilterByComp("Version A")
+	require.NoError(t, err)
+	imgA, err := a.ToPNG()
+	require.NoError(t, err)
+	original, err := tree.ToPNG()
+	require.NoError(t, err)
+	assert.Equal(t, original.Pix, imgA.Pix)
+	b, err := tree.FilterByComp("Version B")
+	require.NoError(t, err)
+	imgB, err := b.ToPNG()
+	require.NoError(t, err)
+	assert.NotEqual(t, imgA.Pix, imgB.Pix)
+
+	// The original tree is unchanged
+	assert.Equal(t, []string{"Version A"}, visibleGroups(tree))
+
+	// A subtree keeps the document's comps
+	group := tree.ChildrenAtPath("Version B")[0]
+	filtered, err := group.FilterByComp("Version B")
+	require.NoError(t, err)
+	assert.True(t, filtered.Visible)
+	assert.Nil(t, filtered.Parent)
+
+	_, err = tree.FilterByComp("Version D")
+	assert.ErrorContains(t, err, "layer comp not found")
+}
+
+// compSettings builds 'shmd' layer metadata holding the given 'cmls'
+// layerSettings descriptors
+func compSettings(settings ...[]byte) []byte {
+	desc := new(bytes.Buffer)
+	writeBE(desc, uint32(16))
+	writeDescriptorHeader(desc, 1)
+	writeDescriptorKey(desc, "layerSettings")
+	desc.WriteString("VlLs")
+	writeBE(desc, uint32(len(settings)))
+	for _, s := range settings {
+		desc.WriteString("Objc")
+		desc.Write(s)
+	}
+
+	buf := new(bytes.Buffer)
+	writeBE(buf, uint32(1))
+	buf.WriteString("8BIMcmls\x00\x00\x00\x00")
+	writeBE(buf, uint32(desc.Len()))
+	buf.Write(desc.Bytes())
+	return buf.Bytes()
+}
+
+// writeDescriptorHeader writes an empty class name, the "null" class ID and
+// the item count
+func writeDescriptorHeader(buf *bytes.Buffer, items uint32) {
+	writeBE(buf, uint32(0))
+	writeBE(buf, uint32(0))
+	buf.WriteString("null")
+	writeBE(buf, items)
+}
+
+func writeDescriptorKey(buf *bytes.Buffer, key string) {
+	if len(key) == 4 {
+		writeBE(buf, uint32(0))
+	} else {
+		writeBE(buf, uint32(len(key)))
+	}
+	buf.WriteString(key)
+}
+
+// compSetting builds a layerSettings descriptor for comp id with the given
+// visibility and, if set, offset and blend mode at 50% opacity
+func compSetting(id int32, visible bool, position *image.Point, blendMode string) []byte {
+	items := uint32(2)
+	if position != nil {
+		items++
+	}
+	if blendMode != "" {
+		items++
+	}
+	buf := new(bytes.Buffer)
+	writeDescriptorHeader(buf, items)
+	writeDescriptorKey(buf, "compList")
+	buf.WriteString("VlLs")
+	writeBE(buf, uint32(1))
+	buf.WriteString("long")
+	writeBE(buf, id)
+	writeDescriptorKey(buf, "enab")
+	buf.WriteString("bool")
+	if visible {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	if position != nil {
+		writeDescriptorKey(buf, "Ofst")
+		buf.WriteString("Objc")
+		writeDescriptorHeader(buf, 2)
+		writeDescriptorKey(buf, "Hrzn")
+		buf.WriteString("long")
+		writeBE(buf, int32(position.X))
+		writeDescriptorKey(buf, "Vrtc")
+		buf.WriteString("long")
+		writeBE(buf, int32(position.Y))
+	}
+	if blendMode != "" {
+		writeDescriptorKey(buf, "blendOptions")
+		buf.WriteString("Objc")
+		writeDescriptorHeader(buf, 2)
+		writeDescriptorKey(buf, "Md  ")
+		buf.WriteString("enum")
+		writeDescriptorKey(buf, "BlnM")
+		writeDescriptorKey(buf, blendMode)
+		writeDescriptorKey(buf, "Opct")
+		buf.WriteString("UntF#Prc")
+		writeBE(buf, 50.0)
+	}
+	return buf.Bytes()
+}
+
+func TestLayerCompState(t *testing.T) {
+	layer := &Layer{Left: 10, Top: 20, Right: 30, Bottom: 40, Opacity: 255, BlendModeKey: "norm"}
+	layer.LayerInfo = map[string][]byte{"shmd": compSettings(
+		compSetting(1, false, nil, ""),
+		compSetting(2, true, &image.Point{X: 100, Y: 5}, "colorBurn"),
+	)}
+
+	settings, err := layer.LayerCompSettings()
+	require.NoError(t, err)
+	require.Len(t, settings, 2)
+	assert.Equal(t, []int{2}, settings[1].CompIDs)
+	assert.Equal(t, &image.Point{X: 100, Y: 5}, settings[1].Position)
+	assert.Equal(t, "color_burn", settings[1].BlendMode)
+
+	state, err := layer.CompState(LayerComp{ID: 1})
+	require.NoError(t, err)
+	assert.False(t, state.Visible)
+	assert.Equal(t, int32(10), state.Left)
+	assert.Equal(t, "normal", state.BlendMode)
+
+	state, err = layer.CompState(LayerComp{ID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, LayerCompState{
+		Visible: true, Left: 100, Top: 5, BlendMode: "color_burn", Opacity: 128, FillOpacity: 255, EffectsVisible: true,
+	}, state)
+
+	// Comps the layer has no settings for keep its state
+	state, err = layer.CompState(LayerComp{ID: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int32(10), state.Left)
+
+	root := &Node{Type: NodeTypeRoot, Visible: true, Right: 200, Bottom: 100}
+	node := &Node{Type: NodeTypeLayer, Layer: layer, Parent: root, Visible: true, Opacity: 255,
+		BlendMode: "normal", Left: 10, Top: 20, Right: 30, Bottom: 40}
+	root.Children = []*Node{node}
+
+	comp := LayerComp{ID: 2, CapturedInfo: LayerCompVisibility | LayerCompPosition | LayerCompAppearance}
+	filtered, err := root.FilterByLayerComp(comp)
+	require.NoError(t, err)
+	moved := filtered.Children[0]
+	assert.Equal(t, []int32{100, 5, 120, 25}, []int32{moved.Left, moved.Top, moved.Right, moved.Bottom})
+	assert.Equal(t, "color_burn", moved.BlendMode)
+	assert.Equal(t, uint8(128), moved.Opacity)
+	assert.Same(t, filtered, moved.Parent)
+	assert.Equal(t, int32(10), node.Left)
+
+	// Only captured properties are applied
+	filtered, err = root.FilterByLayerComp(LayerComp{ID: 1, CapturedInfo: LayerCompPosition})
+	require.NoError(t, err)
+	assert.True(t, filtered.Children[0].Visible)
+
+	// Layer style state
+	hidden := new(bytes.Buffer)
+	writeDescriptorHeader(hidden, 3)
+	writeDescriptorKey(hidden, "compList")
+	hidden.WriteString("VlLs")
+	writeBE(hidden, uint32(1))
+	hidden.WriteString("long")
+	writeBE(hidden, int32(4))
+	writeDescriptorKey(hidden, "layerFXVisible")
+	hidden.WriteString("bool")
+	hidden.WriteByte(0)
+	writeDescriptorKey(hidden, "FXRefPoint")
+	hidden.WriteString("Objc")
+	writeDescriptorHeader(hidden, 2)
+	writeDescriptorKey(hidden, "Hrzn")
+	hidden.WriteString("doub")
+	writeBE(hidden, 12.0)
+	writeDescriptorKey(hidden, "Vrtc")
+	hidden.WriteString("doub")
+	writeBE(hidden, -3.0)
+	layer.LayerInfo["shmd"] = compSettings(hidden.Bytes())
+
+	state, err = layer.CompState(LayerComp{ID: 4})
+	require.NoError(t, err)
+	assert.False(t, state.EffectsVisible)
+	assert.Equal(t, image.Point{X: 12, Y: -3}, state.FXRefPoint)
+	state, err = layer.CompState(LayerComp{ID: 5})
+	require.NoError(t, err)
+	assert.True(t, state.EffectsVisible)
+
+	assert.True(t, node.EffectsVisible())
+	filtered, err = root.FilterByLayerComp(LayerComp{ID: 4, CapturedInfo: LayerCompAppearance})
+	require.NoError(t, err)
+	assert.False(t, filtered.Children[0].EffectsVisible())
+	filtered, err = root.FilterByLayerComp(LayerComp{ID: 4, CapturedInfo: LayerCompVisibility})
+	require.NoError(t, err)
+	assert.True(t, filtered.Children[0].EffectsVisible())
+
+	layer.LayerInfo["shmd"] = []byte{0, 0, 0, 1, '8', 'B'}
+	_, err = layer.LayerCompSettings()
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestRenderComps(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	var names []string
+	images := map[string]image.Image{}
+	err = psd.RenderComps(func(comp LayerComp, img image.Image) error {
+		names = append(names, comp.Name)
+		images[comp.Name] = img
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Version A", "Version B", "Version C"}, names)
+
+	original, err := psd.Tree().ToPNG()
+	require.NoError(t, err)
+	assert.Equal(t, original.Pix, images["Version A"].(*image.RGBA).Pix)
+	assert.NotEqual(t, original.Pix, images["Version B"].(*image.RGBA).Pix)
+
+	// Errors from fn stop rendering
+	stop := errors.New("stop")
+	calls := 0
+	err = psd.RenderComps(func(LayerComp, image.Image) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	// Documents without comps render nothing
+	pixel, err := New("testdata/pixel.psd")
+	require.NoError(t, err)
+	defer pixel.Close()
+	err = pixel.RenderComps(func(LayerComp, image.Image) error {
+		t.Fatal("unexpected layer comp")
+		return nil
+	})
+	assert.NoError(t, err)
+}
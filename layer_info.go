@@ -57,7 +57,7 @@ func parseUnicodeName(reader *bytes.Reader) string {
 		return ""
 	}
 
-	if length == 0 {
+	if length == 0 || uint64(length)*2 > uint64(reader.Len()) {
 		return ""
 	}
 
@@ -1,21 +1,34 @@
 package psd
 
 import (
+	"context"
 	"fmt"
+	"io"
 )
 
 // LayerMask represents the layer and mask information section
 type LayerMask struct {
 	file   *File
 	header *Header
+	colors *ColorOptions
+	state  *parseState
+	psd    *PSD
 	Layers []*Layer
 	tree   *Node
+
+	mergedAlpha bool // the layer count was negative
 }
 
 // Parse parses the layer and mask section
 func (lm *LayerMask) Parse() error {
-	// Read layer and mask information section length
-	length, err := lm.file.ReadUint32()
+	return lm.parse(context.Background())
+}
+
+// parse parses the section, stopping between layers, channels and
+// scanlines when ctx is done
+func (lm *LayerMask) parse(ctx context.Context) error {
+	// Read layer and mask information section length (8 bytes in PSB)
+	length, err := lm.file.ReadLength(lm.header.IsBig())
 	if err != nil {
 		return fmt.Errorf("failed to read layer mask length: %w", err)
 	}
@@ -32,21 +45,24 @@ func (lm *LayerMask) Parse() error {
 	}
 	endPos := startPos + int64(length)
 
-	// Parse layer info
-	if err := lm.parseLayerInfo(); err != nil {
-		return fmt.Errorf("failed to parse layer info: %w", err)
+	// Parse layer info, then global mask info and additional layer info.
+	// In lenient mode the layers decoded so far are kept on error.
+	if err := lm.parseLayerInfo(ctx); err != nil {
+		err = newParseError(SectionLayers, -1, "", startPos, fmt.Errorf("failed to parse layer info: %w", err))
+		if !lm.state.recover(err) {
+			return err
+		}
+	} else if err := lm.parseGlobalInfo(ctx, endPos); err != nil {
+		err = newParseError(SectionLayers, -1, "", startPos, fmt.Errorf("failed to parse global layer info: %w", err))
+		if !lm.state.recover(err) {
+			return err
+		}
 	}
 
-	// Skip to end of section if needed
-	currentPos, err := lm.file.Tell()
-	if err != nil {
+	// Seek to end of section
+	if _, err := lm.file.Seek(endPos, io.SeekStart); err != nil {
 		return err
 	}
-	if currentPos < endPos {
-		if err := lm.file.Skip(endPos - currentPos); err != nil {
-			return err
-		}
-	}
 
 	// Build tree structure
 	lm.buildTree()
@@ -54,9 +70,9 @@ func (lm *LayerMask) Parse() error {
 	return nil
 }
 
-func (lm *LayerMask) parseLayerInfo() error {
-	// Read layer info section length
-	length, err := lm.file.ReadUint32()
+func (lm *LayerMask) parseLayerInfo(ctx context.Context) error {
+	// Read layer info section length (8 bytes in PSB)
+	length, err := lm.file.ReadLength(lm.header.IsBig())
 	if err != nil {
 		return err
 	}
@@ -66,46 +82,302 @@ func (lm *LayerMask) parseLayerInfo() error {
 		return nil
 	}
 
+	startPos, err := lm.file.Tell()
+	if err != nil {
+		return err
+	}
+
+	if err := lm.parseLayers(ctx); err != nil {
+		return err
+	}
+
+	// Skip padding at the end of the layer info
+	_, err = lm.file.Seek(startPos+int64(length), io.SeekStart)
+	return err
+}
+
+// parseGlobalInfo parses the global layer mask info and the additional layer
+// info blocks that follow the layer info, up to endPos. In 16 and 32-bit
+// documents the layers are stored in the Lr16 or Lr32 block instead of the
+// layer info.
+func (lm *LayerMask) parseGlobalInfo(ctx context.Context, endPos int64) error {
+	return readGlobalBlocks(lm.file, lm.header, endPos, func(key string, dataLen uint64) error {
+		if (key == "Lr16" || key == "Lr32") && len(lm.Layers) == 0 && dataLen > 0 {
+			if err := lm.parseLayers(ctx); err != nil {
+				return fmt.Errorf("failed to parse %s layers: %w", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// readGlobalBlocks skips the global layer mask info at the current position
+// and calls fn with the file positioned at the data of each additional layer
+// info block that follows, up to endPos
+func readGlobalBlocks(file *File, header *Header, endPos int64, fn func(key string, dataLen uint64) error) error {
+	pos, err := file.Tell()
+	if err != nil {
+		return err
+	}
+	if pos+4 > endPos {
+		return nil
+	}
+
+	// Skip global layer mask info
+	maskLen, err := file.ReadUint32()
+	if err != nil {
+		return err
+	}
+	if err := file.Skip(int64(maskLen)); err != nil {
+		return err
+	}
+
+	for {
+		pos, err := file.Tell()
+		if err != nil {
+			return err
+		}
+		if pos+12 > endPos {
+			return nil
+		}
+
+		sig, err := file.ReadString(4)
+		if err != nil {
+			return err
+		}
+		if sig != "8BIM" && sig != "8B64" {
+			return nil
+		}
+
+		key, err := file.ReadString(4)
+		if err != nil {
+			return err
+		}
+
+		dataLen, err := file.ReadLength(header.IsBig() && (sig == "8B64" || bigLayerInfoKeys[key]))
+		if err != nil {
+			return err
+		}
+
+		dataStart, err := file.Tell()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(key, dataLen); err != nil {
+			return err
+		}
+
+		// Block data is padded to a multiple of 4 bytes
+		if rem := dataLen % 4; rem != 0 {
+			dataLen += 4 - rem
+		}
+		if _, err := file.Seek(dataStart+int64(dataLen), io.SeekStart); err != nil {
+			return err
+		}
+	}
+}
+
+// readLayerCount reads the signed layer count of the layer and mask section
+// at the current position without parsing the layers. It returns 0 if the
+// document has no layers.
+func readLayerCount(file *File, header *Header) (int16, error) {
+	length, err := file.ReadLength(header.IsBig())
+	if err != nil || length == 0 {
+		return 0, err
+	}
+	start, err := file.Tell()
+	if err != nil {
+		return 0, err
+	}
+
+	infoLength, err := file.ReadLength(header.IsBig())
+	if err != nil {
+		return 0, err
+	}
+	if infoLength > 0 {
+		return file.ReadInt16()
+	}
+
+	// 16 and 32-bit documents keep the layers in an Lr16 or Lr32 block
+	var count int16
+	err = readGlobalBlocks(file, header, start+int64(length), func(key string, dataLen uint64) error {
+		if (key == "Lr16" || key == "Lr32") && count == 0 && dataLen >= 2 {
+			count, err = file.ReadInt16()
+			return err
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MergedAlpha reports whether the layer count was negative, which marks the
+// first alpha channel of the composite image as its transparency
+func (lm *LayerMask) MergedAlpha() bool {
+	return lm.mergedAlpha
+}
+
+// parseLayers parses the layer count, layer records and channel image data.
+// In lenient mode, damaged records are skipped using their extra data
+// length and damaged channels are left out. On error the channels decoded
+// so far are released.
+func (lm *LayerMask) parseLayers(ctx context.Context) (err error) {
 	// Read layer count
-	layerCount, err := lm.file.ReadInt16()
+	count, err := lm.file.ReadInt16()
 	if err != nil {
 		return err
 	}
 
 	// Negative layer count means first alpha channel contains transparency data
+	layerCount := int(count)
 	if layerCount < 0 {
 		layerCount = -layerCount
+		lm.mergedAlpha = true
 	}
 
-	lm.Layers = make([]*Layer, layerCount)
+	if max := lm.state.limits().MaxLayers; max > 0 && layerCount > max {
+		return fmt.Errorf("%w: %d layers exceed %d", ErrLimitExceeded, layerCount, max)
+	}
+
+	layers := make([]*Layer, 0, layerCount)
+	broken := make(map[*Layer]bool)
+	defer func() {
+		if err != nil {
+			for _, layer := range layers {
+				layer.ReleaseChannels()
+			}
+		}
+	}()
 
 	// Parse layer records
-	for i := int16(0); i < layerCount; i++ {
+	for i := 0; i < layerCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		layer := &Layer{
 			file:   lm.file,
 			header: lm.header,
+			colors: lm.colors,
+			state:  lm.state,
+			index:  i,
+		}
+
+		recordPos, err := lm.file.Tell()
+		if err != nil {
+			return err
 		}
 		if err := layer.parseRecord(); err != nil {
-			return fmt.Errorf("failed to parse layer %d: %w", i, err)
+			err = layer.parseError("", recordPos, err)
+			if !lm.state.recover(err) {
+				return err
+			}
+			if layer.recordEnd == 0 {
+				// The record's length is unknown, so neither the following
+				// records nor the channel data of any layer can be located.
+				// Every layer is dropped rather than kept without pixels.
+				lm.Layers = []*Layer{}
+				return nil
+			}
+			if _, err := lm.file.Seek(layer.recordEnd, io.SeekStart); err != nil {
+				return err
+			}
+			broken[layer] = true
+		}
+		layers = append(layers, layer)
+	}
+
+	// Parse layer channel image data. The channels are read in file order
+	// and decoded concurrently, a batch of layers at a time.
+	var batch []*Layer
+	var batchJobs [][]*channelJob
+	var batchBytes int64
+	for i, layer := range layers {
+		if err := ctx.Err(); err != nil {
+			releaseBatch(batchJobs)
+			return err
+		}
+		dataPos, err := lm.file.Tell()
+		if err != nil {
+			releaseBatch(batchJobs)
+			return err
+		}
+		if broken[layer] {
+			err = layer.skipChannelData()
+		} else {
+			var jobs []*channelJob
+			jobs, err = layer.readChannelData(ctx)
+			if err == nil && jobs != nil {
+				batch = append(batch, layer)
+				batchJobs = append(batchJobs, jobs)
+				for _, job := range jobs {
+					batchBytes += int64(len(job.compressed))
+				}
+			}
+		}
+		if err != nil {
+			releaseBatch(batchJobs)
+			return layer.parseError("", dataPos, err)
+		}
+
+		if batchBytes >= channelBatchBytes || i == len(layers)-1 {
+			if err := lm.decodeBatch(ctx, batch, batchJobs); err != nil {
+				return err
+			}
+			batch, batchJobs, batchBytes = nil, nil, 0
 		}
-		lm.Layers[i] = layer
 	}
 
-	// Parse layer channel image data
-	for i, layer := range lm.Layers {
-		if err := layer.parseChannelData(); err != nil {
-			return fmt.Errorf("failed to parse channel data for layer %d (%s): %w", i, layer.Name, err)
+	kept := layers[:0]
+	for _, layer := range layers {
+		if !broken[layer] {
+			kept = append(kept, layer)
 		}
 	}
 
 	// Reverse layers array to match Ruby's order (top to bottom instead of bottom to top)
-	for i, j := 0, len(lm.Layers)-1; i < j; i, j = i+1, j-1 {
-		lm.Layers[i], lm.Layers[j] = lm.Layers[j], lm.Layers[i]
+	lm.Layers = reverseLayers(kept)
+
+	return nil
+}
+
+// channelBatchBytes is the compressed size of the channels read ahead
+// before they are decoded
+const channelBatchBytes = 32 << 20
+
+// decodeBatch decodes the channels of batch, whose jobs are in batchJobs, and
+// stores them in layer order
+func (lm *LayerMask) decodeBatch(ctx context.Context, batch []*Layer, batchJobs [][]*channelJob) error {
+	var all []*channelJob
+	for _, jobs := range batchJobs {
+		all = append(all, jobs...)
 	}
+	decodeChannelJobs(ctx, lm.state, all)
 
+	for i, layer := range batch {
+		if err := layer.finishChannels(batchJobs[i]); err != nil {
+			releaseBatch(batchJobs[i+1:])
+			return err
+		}
+	}
 	return nil
 }
 
+// releaseBatch releases the bytes reserved by channels that will not be
+// stored
+func releaseBatch(batchJobs [][]*channelJob) {
+	for _, jobs := range batchJobs {
+		releaseChannelJobs(jobs)
+	}
+}
+
+// reverseLayers reverses layers in place and returns them
+func reverseLayers(layers []*Layer) []*Layer {
+	for i, j := 0, len(layers)-1; i < j; i, j = i+1, j-1 {
+		layers[i], layers[j] = layers[j], layers[i]
+	}
+	return layers
+}
+
 func (lm *LayerMask) buildTree() {
 	root := &Node{
 		Type:     NodeTypeRoot,
@@ -117,6 +389,7 @@ func (lm *LayerMask) buildTree() {
 		Bottom:   int32(lm.header.Height()),
 		Visible:  true,
 		Opacity:  255,
+		psd:      lm.psd,
 	}
 
 	stack := []*Node{root}
@@ -146,6 +419,7 @@ func (lm *LayerMask) buildTree() {
 					Top:       layer.Top,
 					Right:     layer.Right,
 					Bottom:    layer.Bottom,
+					psd:       lm.psd,
 				}
 				node.Parent = stack[len(stack)-1]
 				stack = append(stack, node)
@@ -164,6 +438,7 @@ func (lm *LayerMask) buildTree() {
 				Top:       layer.Top,
 				Right:     layer.Right,
 				Bottom:    layer.Bottom,
+				psd:       lm.psd,
 			}
 			parent := stack[len(stack)-1]
 			node.Parent = parent
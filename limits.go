@@ -0,0 +1,118 @@
+package psd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is returned (wrapped) when a document exceeds one of the
+// configured Limits
+var ErrLimitExceeded = errors.New("psd: limit exceeded")
+
+// Limits bounds the memory and work parsing may use, so that hostile files
+// cannot trigger huge allocations. A zero field uses the value from
+// DefaultLimits; a negative field disables that limit.
+type Limits struct {
+	// MaxWidth and MaxHeight bound the document, layer and mask size in
+	// pixels
+	MaxWidth  int
+	MaxHeight int
+
+	// MaxLayers bounds the number of layer records
+	MaxLayers int
+
+	// MaxDecodedBytes bounds the total size of the channel and composite
+	// buffers decoded for one document
+	MaxDecodedBytes int64
+
+	// MaxDescriptorDepth bounds the nesting of descriptors and lists
+	MaxDescriptorDepth int
+
+	// MaxResourceSize bounds the size of a single image resource or
+	// additional layer information block
+	MaxResourceSize int64
+}
+
+// DefaultLimits are the limits used when none are configured. The maximum
+// dimensions are those of the PSB format.
+var DefaultLimits = Limits{
+	MaxWidth:           300000,
+	MaxHeight:          300000,
+	MaxLayers:          10000,
+	MaxDecodedBytes:    4 << 30,
+	MaxDescriptorDepth: 64,
+	MaxResourceSize:    512 << 20,
+}
+
+// withDefaults returns l with zero fields replaced by DefaultLimits
+func (l Limits) withDefaults() Limits {
+	if l.MaxWidth == 0 {
+		l.MaxWidth = DefaultLimits.MaxWidth
+	}
+	if l.MaxHeight == 0 {
+		l.MaxHeight = DefaultLimits.MaxHeight
+	}
+	if l.MaxLayers == 0 {
+		l.MaxLayers = DefaultLimits.MaxLayers
+	}
+	if l.MaxDecodedBytes == 0 {
+		l.MaxDecodedBytes = DefaultLimits.MaxDecodedBytes
+	}
+	if l.MaxDescriptorDepth == 0 {
+		l.MaxDescriptorDepth = DefaultLimits.MaxDescriptorDepth
+	}
+	if l.MaxResourceSize == 0 {
+		l.MaxResourceSize = DefaultLimits.MaxResourceSize
+	}
+	return l
+}
+
+// checkSize returns an error if width x height exceeds the maximum
+// dimensions
+func (l Limits) checkSize(what string, width, height int64) error {
+	if width < math.MinInt32 || height < math.MinInt32 {
+		return fmt.Errorf("invalid %s size %dx%d", what, width, height)
+	}
+	if l.MaxWidth > 0 && width > int64(l.MaxWidth) {
+		return fmt.Errorf("%w: %s width %d exceeds %d", ErrLimitExceeded, what, width, l.MaxWidth)
+	}
+	if l.MaxHeight > 0 && height > int64(l.MaxHeight) {
+		return fmt.Errorf("%w: %s height %d exceeds %d", ErrLimitExceeded, what, height, l.MaxHeight)
+	}
+	return nil
+}
+
+// checkResource returns an error if a resource or block of n bytes exceeds
+// the maximum resource size
+func (l Limits) checkResource(what string, n uint64) error {
+	if l.MaxResourceSize > 0 && n > uint64(l.MaxResourceSize) {
+		return fmt.Errorf("%w: %s of %d bytes exceeds %d", ErrLimitExceeded, what, n, l.MaxResourceSize)
+	}
+	return nil
+}
+
+// decodeBudget tracks the bytes decoded for one document against
+// Limits.MaxDecodedBytes
+type decodeBudget struct {
+	used atomic.Int64
+}
+
+// reserve accounts for n more decoded bytes, failing if that exceeds max
+func (b *decodeBudget) reserve(n, max int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: invalid buffer size %d", ErrLimitExceeded, n)
+	}
+	used := b.used.Add(n)
+	if max > 0 && used > max {
+		b.used.Add(-n)
+		return fmt.Errorf("%w: decoding %d more bytes exceeds %d", ErrLimitExceeded, n, max)
+	}
+	return nil
+}
+
+// release returns n decoded bytes to the budget
+func (b *decodeBudget) release(n int64) {
+	b.used.Add(-n)
+}
@@ -0,0 +1,179 @@
+package psd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseWithLimits(data []byte, limits Limits) error {
+	psd, err := NewFromBytes(data)
+	if err != nil {
+		return err
+	}
+	return psd.ParseWithOptions(ParseOptions{Limits: limits})
+}
+
+func TestLimitsDimensions(t *testing.T) {
+	data := errorDoc().build()
+	assert.NoError(t, parseWithLimits(data, Limits{}))
+
+	err := parseWithLimits(data, Limits{MaxWidth: 1})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, SectionHeader, pe.Section)
+}
+
+func TestLimitsHostileHeader(t *testing.T) {
+	// A tiny file claiming a huge raw composite must fail before allocating
+	data := errorDoc().build()
+	binary.BigEndian.PutUint32(data[14:], 300000)
+	binary.BigEndian.PutUint32(data[18:], 300000)
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	err = psd.ParseWithOptions(ParseOptions{SkipLayers: true})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	err = parseWithLimits(data, Limits{MaxWidth: -1, MaxHeight: -1, MaxDecodedBytes: -1})
+	assert.Error(t, err)
+}
+
+func TestLimitsLayers(t *testing.T) {
+	err := parseWithLimits(errorDoc().build(), Limits{MaxLayers: 1})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	doc := errorDoc()
+	doc.layers[0].right = 400001
+	err = parseWithLimits(doc.build(), Limits{})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
+
+func TestLimitsResourceSize(t *testing.T) {
+	err := parseWithLimits(errorDoc().build(), Limits{MaxResourceSize: 2})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, SectionResources, pe.Section)
+	assert.Equal(t, "1037", pe.Key)
+}
+
+func TestLimitsDecodedBytes(t *testing.T) {
+	// The composite takes 12 channel bytes and 16 pixel bytes, each layer
+	// 12 channel bytes
+	limits := Limits{MaxDecodedBytes: 28 + 12}
+
+	err := parseWithLimits(errorDoc().build(), limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	psd, err := NewFromBytes(errorDoc().build())
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{LazyChannels: true, Limits: limits}))
+	psd.Image().PixelData()
+
+	layers := psd.Layers()
+	require.NoError(t, layers[0].LoadChannels())
+	assert.ErrorIs(t, layers[1].LoadChannels(), ErrLimitExceeded)
+
+	// Released channels return their bytes to the budget
+	layers[0].ReleaseChannels()
+	assert.NoError(t, layers[1].LoadChannels())
+}
+
+func TestLimitsZIPComposite(t *testing.T) {
+	// The composite decodes to 18 channel bytes and 24 pixel bytes, and the
+	// compressed stream is reserved while it is inflated
+	limits := Limits{MaxDecodedBytes: 18 + 24}
+	parse := func(compression uint16, limits Limits) error {
+		doc := zipDoc(8, compression, fill(1, 6), fill(2, 6), fill(3, 6))
+		psd, err := NewFromBytes(doc.build())
+		require.NoError(t, err)
+		return psd.ParseWithOptions(ParseOptions{SkipLayers: true, Limits: limits})
+	}
+
+	assert.NoError(t, parse(CompressionRaw, limits))
+	assert.ErrorIs(t, parse(CompressionZIP, limits), ErrLimitExceeded)
+	assert.NoError(t, parse(CompressionZIP, Limits{MaxDecodedBytes: 18 + 24 + 64}))
+}
+
+func TestLimitsDescriptorDepth(t *testing.T) {
+	_, err := NewDescriptorParser(testDescriptor(100)).Parse()
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	result, err := NewDescriptorParserWithLimits(testDescriptor(100), Limits{MaxDescriptorDepth: 100}).Parse()
+	require.NoError(t, err)
+	assert.Contains(t, result, "chld")
+
+	// Lists count towards the depth
+	list := new(bytes.Buffer)
+	writeBE(list, uint32(0))
+	writeBE(list, uint32(0))
+	list.WriteString("null")
+	writeBE(list, uint32(1))
+	writeBE(list, uint32(0))
+	list.WriteString("lst VlLs")
+	writeBE(list, uint32(1))
+	list.WriteString("Objc")
+	list.Write(testDescriptor(1))
+
+	_, err = NewDescriptorParserWithLimits(list.Bytes(), Limits{MaxDescriptorDepth: 2}).Parse()
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = NewDescriptorParserWithLimits(list.Bytes(), Limits{MaxDescriptorDepth: 3}).Parse()
+	assert.NoError(t, err)
+}
+
+func TestLimitsDescriptorDepthOptions(t *testing.T) {
+	// A text layer whose descriptor nests 10 objects
+	tySh := new(bytes.Buffer)
+	writeBE(tySh, uint16(1))
+	tySh.Write(make([]byte, 6*8))
+	writeBE(tySh, uint16(50))
+	writeBE(tySh, uint32(16))
+	tySh.Write(testDescriptor(10))
+
+	doc := errorDoc()
+	doc.layers[0].info = []testInfo{{key: "TySh", data: tySh.Bytes()}}
+	versioned := append([]byte{0, 0, 0, 16}, testDescriptor(10)...)
+	doc.resources = append(doc.resources, testResource{id: 1065, data: versioned})
+	data := doc.build()
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+	assert.NotNil(t, psd.Layers()[1].TypeTool)
+
+	limits := Limits{MaxDescriptorDepth: 5}
+	err = parseWithLimits(data, limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "TySh", pe.Key)
+
+	// Lenient parsing drops the text information
+	psd, err = NewFromBytes(data)
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true, Limits: limits}))
+	assert.Nil(t, psd.Layers()[1].TypeTool)
+	require.Len(t, psd.Warnings(), 1)
+
+	// Resource descriptors are parsed within the same limits
+	_, err = psd.Resources().ParseLayerComps()
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = psd.Resources().Decode(1065)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
+
+func TestDescriptorHostileLengths(t *testing.T) {
+	// A list claiming 2^32-1 items in a few bytes must not allocate them
+	data := testDescriptor(1)
+	data = append(data[:len(data)-8], []byte("VlLs\xff\xff\xff\xff")...)
+
+	_, err := NewDescriptorParser(data).Parse()
+	assert.ErrorIs(t, err, ErrTruncated)
+}
@@ -0,0 +1,246 @@
+package psd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmp:CreatorTool="Adobe Photoshop CS6 (Macintosh)"
+    photoshop:ColorMode="3">
+   <xmp:CreateDate>2014-01-13T18:03:35-06:00</xmp:CreateDate>
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Sunset</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>Jane Doe</rdf:li><rdf:li>John Roe</rdf:li></rdf:Seq></dc:creator>
+   <dc:rights><rdf:Alt><rdf:li xml:lang="x-default">© 2014 Jane Doe</rdf:li></rdf:Alt></dc:rights>
+   <dc:subject><rdf:Bag><rdf:li>beach</rdf:li><rdf:li>sky</rdf:li></rdf:Bag></dc:subject>
+   <xmpMM:History>
+    <rdf:Seq>
+     <rdf:li rdf:parseType="Resource"><stEvt:action>created</stEvt:action></rdf:li>
+    </rdf:Seq>
+   </xmpMM:History>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestXMP(t *testing.T) {
+	x, err := parseXMP(append([]byte(testXMP), 0, 0))
+	require.NoError(t, err)
+
+	assert.Equal(t, testXMP, x.Raw)
+	assert.Equal(t, "Sunset", x.Title)
+	assert.Equal(t, []string{"Jane Doe", "John Roe"}, x.Creators)
+	assert.Equal(t, "© 2014 Jane Doe", x.Rights)
+	assert.Equal(t, []string{"beach", "sky"}, x.Subjects)
+	assert.Equal(t, "Adobe Photoshop CS6 (Macintosh)", x.CreatorTool)
+	assert.Equal(t, "3", x.ColorMode)
+
+	// Structured items have no text value
+	assert.NotContains(t, x.Properties, "xmpMM:History")
+
+	created, err := x.Created()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2014, 1, 14, 0, 3, 35, 0, time.UTC), created.UTC())
+
+	_, err = parseXMP([]byte("<x:xmpmeta><rdf:RDF>"))
+	assert.Error(t, err)
+}
+
+func TestXMPFixture(t *testing.T) {
+	psd, err := New("testdata/blendmodes.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	x, err := psd.XMP()
+	require.NoError(t, err)
+	require.NotNil(t, x)
+	assert.Equal(t, "Adobe Photoshop CS6 (Macintosh)", x.CreatorTool)
+	assert.Equal(t, "2014-01-13T18:03:35-06:00", x.CreateDate)
+	assert.Equal(t, "application/vnd.adobe.photoshop", x.Format)
+	assert.Contains(t, x.Raw, "<x:xmpmeta")
+}
+
+// exifEntry is an IFD entry whose value fits in the entry or is stored at
+// offset
+type exifEntry struct {
+	id, typ uint16
+	count   uint32
+	value   uint32
+}
+
+func buildEXIF(order binary.ByteOrder, ifds ...[]exifEntry) []byte {
+	buf := new(bytes.Buffer)
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, order, uint16(42))
+	binary.Write(buf, order, uint32(8))
+	offset := uint32(8)
+	for i, ifd := range ifds {
+		offset += 2 + uint32(len(ifd))*12 + 4
+		binary.Write(buf, order, uint16(len(ifd)))
+		for _, e := range ifd {
+			binary.Write(buf, order, e)
+		}
+		next := uint32(0)
+		if i < len(ifds)-1 {
+			next = offset
+		}
+		binary.Write(buf, order, next)
+	}
+	return buf.Bytes()
+}
+
+func TestEXIF(t *testing.T) {
+	order := binary.LittleEndian
+	// The Exif IFD follows IFD0 and ASCII values longer than four bytes are
+	// appended after it
+	ifd0 := []exifEntry{
+		{EXIFTagOrientation, EXIFTypeShort, 1, 6},
+		{EXIFTagExifIFD, EXIFTypeLong, 1, 8 + 2 + 2*12 + 4},
+	}
+	exif := []exifEntry{
+		{EXIFTagDateTimeOriginal, EXIFTypeASCII, 20, 0},
+		{EXIFTagPixelXDimension, EXIFTypeLong, 1, 640},
+	}
+	dateOffset := uint32(8 + 2 + 2*12 + 4 + 2 + 2*12 + 4)
+	exif[0].value = dateOffset
+	data := buildEXIF(order, ifd0)
+	exifIFD := buildEXIF(order, exif)[8:]
+	data = append(data, exifIFD...)
+	data = append(data, "2020:05:17 09:30:00\x00"...)
+
+	e, err := parseEXIF(data)
+	require.NoError(t, err)
+	assert.Equal(t, binary.ByteOrder(binary.LittleEndian), e.ByteOrder)
+	assert.Equal(t, 6, e.Orientation)
+	assert.Equal(t, "2020:05:17 09:30:00", e.DateTimeOriginal)
+
+	tag, ok := e.Tag(EXIFTagPixelXDimension)
+	require.True(t, ok)
+	assert.Equal(t, EXIFExif, tag.IFD)
+	width, _ := tag.Int()
+	assert.Equal(t, int64(640), width)
+
+	created, err := e.Created()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 5, 17, 9, 30, 0, 0, time.UTC), created)
+}
+
+func TestEXIFInvalid(t *testing.T) {
+	_, err := parseEXIF([]byte("XX\x00\x2a\x00\x00\x00\x08"))
+	assert.ErrorIs(t, err, ErrInvalidEXIF)
+
+	// An IFD pointing to itself
+	loop := buildEXIF(binary.BigEndian, []exifEntry{{EXIFTagOrientation, EXIFTypeShort, 1, 1 << 16}})
+	binary.BigEndian.PutUint32(loop[len(loop)-4:], 8)
+	_, err = parseEXIF(loop)
+	assert.ErrorIs(t, err, ErrInvalidEXIF)
+
+	// Values out of range are skipped
+	e, err := parseEXIF(buildEXIF(binary.BigEndian, []exifEntry{
+		{EXIFTagArtist, EXIFTypeASCII, 100, 1000},
+		{EXIFTagOrientation, EXIFTypeShort, 1, 3 << 16},
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, e.Artist)
+	assert.Equal(t, 3, e.Orientation)
+}
+
+func TestEXIFFixture(t *testing.T) {
+	psd, err := New("testdata/blendmodes.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	e, err := psd.EXIF()
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, binary.ByteOrder(binary.BigEndian), e.ByteOrder)
+	assert.Equal(t, "Adobe Photoshop CC (Macintosh)", e.Software)
+	assert.Equal(t, "2014:04:07 11:34:15", e.DateTime)
+
+	tag, ok := e.Tag(EXIFTagPixelYDimension)
+	require.True(t, ok)
+	assert.Equal(t, EXIFExif, tag.IFD)
+	height, _ := tag.Int()
+	assert.Equal(t, int64(480), height)
+}
+
+func iptcDataSet(buf *bytes.Buffer, dataSet uint8, value string) {
+	buf.Write([]byte{0x1C, 2, dataSet})
+	writeBE(buf, uint16(len(value)))
+	buf.WriteString(value)
+}
+
+func TestIPTC(t *testing.T) {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0x1C, 1, 90, 0, 3, 0x1B, '%', 'G'})
+	iptcDataSet(buf, IPTCObjectName, "Sunset")
+	iptcDataSet(buf, IPTCKeywords, "beach")
+	iptcDataSet(buf, IPTCKeywords, "sky")
+	iptcDataSet(buf, IPTCByline, "Jane Doe")
+	iptcDataSet(buf, IPTCCopyright, "\xa9 2014") // Latin-1
+	iptcDataSet(buf, IPTCDateCreated, "20140113")
+	iptcDataSet(buf, IPTCTimeCreated, "180335-0600")
+	// Extended dataset with a two byte length
+	buf.Write([]byte{0x1C, 2, IPTCCaption, 0x80, 2, 0, 5})
+	buf.WriteString("Beach")
+	buf.WriteByte(0) // Padding
+
+	record, err := parseIPTC(buf.Bytes())
+	require.NoError(t, err)
+	assert.Len(t, record.DataSets, 9)
+	assert.Equal(t, "Sunset", record.ObjectName)
+	assert.Equal(t, []string{"beach", "sky"}, record.Keywords)
+	assert.Equal(t, []string{"Jane Doe"}, record.Byline)
+	assert.Equal(t, "© 2014", record.Copyright)
+	assert.Equal(t, "Beach", record.Caption)
+
+	created, err := record.Created()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2014, 1, 14, 0, 3, 35, 0, time.UTC), created.UTC())
+
+	_, err = parseIPTC([]byte{0x1C, 2, 5, 0, 10, 'a'})
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestMetadataFixture(t *testing.T) {
+	psd, err := New("testdata/blendmodes.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	record, err := psd.IPTC()
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Len(t, record.DataSets, 2)
+	assert.Empty(t, record.Keywords)
+
+	// Documents without the resources
+	doc := &testDoc{version: 1, channels: 3, width: 1, height: 1, depth: 8, mode: 3}
+	psd, err = NewFromBytes(doc.build())
+	require.NoError(t, err)
+	x, err := psd.XMP()
+	assert.NoError(t, err)
+	assert.Nil(t, x)
+	e, err := psd.EXIF()
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+	record, err = psd.IPTC()
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+}
@@ -1,7 +1,6 @@
 package psd
 
 import (
-	"fmt"
 	"image"
 	"strings"
 )
@@ -27,6 +26,10 @@ type Node struct {
 	Top       int32
 	Right     int32
 	Bottom    int32
+
+	psd            *PSD   // Document the tree was read from, for its layer comps
+	fillOpacity    *uint8 // Set by FilterByLayerComp
+	effectsVisible *bool  // Set by FilterByLayerComp
 }
 
 // Root returns the root node of the tree
@@ -200,13 +203,6 @@ func (n *Node) findAtPath(parts []string) []*Node {
 	return results
 }
 
-// FilterByComp filters the tree by layer comp
-func (n *Node) FilterByComp(compName string) (*Node, error) {
-	// This would require parsing layer comp data from resources
-	// For now, return error indicating not implemented
-	return nil, fmt.Errorf("layer comp not found")
-}
-
 // ToHash converts the node tree to a hash/map structure
 func (n *Node) ToHash() map[string]interface{} {
 	result := map[string]interface{}{
@@ -246,7 +242,7 @@ func (n *Node) Height() int32 {
 
 // IsEmpty returns whether this node is empty (zero size)
 func (n *Node) IsEmpty() bool {
-	return n.Width() == 0 || n.Height() == 0
+	return n.Width() <= 0 || n.Height() <= 0
 }
 
 // IsVisible returns whether the node is visible
@@ -278,14 +274,27 @@ func (n *Node) GetTextContent() string {
 	return ""
 }
 
-// FillOpacity returns the fill opacity (default 255 for now)
+// FillOpacity returns the fill opacity set by the layer comp applied with
+// FilterByLayerComp, or else the layer's (255 for nodes without a layer)
 func (n *Node) FillOpacity() uint8 {
+	if n.fillOpacity != nil {
+		return *n.fillOpacity
+	}
 	if n.Layer != nil {
 		return n.Layer.GetFillOpacity()
 	}
 	return 255
 }
 
+// EffectsVisible returns whether the layer style is shown in the layer comp
+// applied with FilterByLayerComp. It is true for nodes no comp changed.
+func (n *Node) EffectsVisible() bool {
+	if n.effectsVisible != nil {
+		return *n.effectsVisible
+	}
+	return true
+}
+
 // GetLayerID returns the layer ID
 func (n *Node) GetLayerID() int32 {
 	if n.Layer != nil {
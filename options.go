@@ -0,0 +1,112 @@
+package psd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ParseOptions controls how a document is parsed
+type ParseOptions struct {
+	// SkipResources, SkipLayers and SkipImage leave the image resources,
+	// the layer and mask section, and the composite image unparsed. Each
+	// section is located from its length prefix, so skipped sections are
+	// still parsed on first access by Resources, Layers, Tree or Image.
+	SkipResources bool
+	SkipLayers    bool
+	SkipImage     bool
+
+	// LazyChannels defers decoding layer channel image data. Parsing only
+	// records where each channel is stored; pixels are decoded when
+	// Layer.ToImage, Layer.Channel, Layer.LoadChannels or the renderer
+	// needs them. The PSD must stay open until then.
+	LazyChannels bool
+
+	// Lenient recovers from corrupt or unsupported data instead of failing.
+	// Damaged resources, layer records, blocks and channels are skipped
+	// using their length prefixes, every layer that can be decoded is kept
+	// and each recovered error is reported by PSD.Warnings. Errors in the
+	// file header are still returned.
+	Lenient bool
+
+	// Limits bounds the memory parsing may use. Zero fields use
+	// DefaultLimits.
+	Limits Limits
+
+	// Concurrency bounds the number of goroutines decoding layer channels
+	// and composite image channels. Zero uses runtime.GOMAXPROCS(0); 1
+	// decodes serially. The decoded data does not depend on the setting.
+	Concurrency int
+}
+
+// parseState is shared by the section parsers of one document. Lazily
+// decoded layers may record warnings from several goroutines.
+type parseState struct {
+	opts   ParseOptions
+	budget decodeBudget
+
+	mu       sync.Mutex
+	warnings []*ParseError
+}
+
+// limits returns the configured limits with defaults applied
+func (s *parseState) limits() Limits {
+	if s == nil {
+		return DefaultLimits
+	}
+	return s.opts.Limits.withDefaults()
+}
+
+// reserve accounts for a decoded buffer of n bytes
+func (s *parseState) reserve(n int64) error {
+	if s == nil {
+		var budget decodeBudget
+		return budget.reserve(n, DefaultLimits.MaxDecodedBytes)
+	}
+	return s.budget.reserve(n, s.limits().MaxDecodedBytes)
+}
+
+// release returns a decoded buffer of n bytes to the budget
+func (s *parseState) release(n int64) {
+	if s != nil {
+		s.budget.release(n)
+	}
+}
+
+func (s *parseState) lazyChannels() bool {
+	return s != nil && s.opts.LazyChannels
+}
+
+func (s *parseState) lenient() bool {
+	return s != nil && s.opts.Lenient
+}
+
+// recover records err as a warning and reports whether parsing may go on.
+// It returns false in strict mode, where the caller fails with err.
+func (s *parseState) recover(err error) bool {
+	if !s.lenient() || isContextError(err) {
+		return false
+	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		pe = &ParseError{Layer: -1, Err: err}
+	}
+	s.mu.Lock()
+	s.warnings = append(s.warnings, pe)
+	s.mu.Unlock()
+	return true
+}
+
+// warningList returns a copy of the warnings recorded so far
+func (s *parseState) warningList() []*ParseError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ParseError(nil), s.warnings...)
+}
+
+// isContextError reports whether err comes from a cancelled context, which
+// is never recovered from
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,126 @@
+package psd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyChannels(t *testing.T) {
+	eager, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer eager.Close()
+	require.NoError(t, eager.Parse())
+
+	lazy, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer lazy.Close()
+	require.NoError(t, lazy.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	eagerLayers := eager.Layers()
+	lazyLayers := lazy.Layers()
+	require.Equal(t, len(eagerLayers), len(lazyLayers))
+
+	for i, layer := range lazyLayers {
+		assert.Nil(t, layer.ChannelData, "layer %d decoded while parsing", i)
+		require.NoError(t, layer.LoadChannels())
+		assert.Equal(t, eagerLayers[i].ChannelData, layer.ChannelData, "layer %d", i)
+	}
+
+	// Released channels are decoded again on demand
+	layer := lazyLayers[len(lazyLayers)-1]
+	want := layer.ChannelData[0]
+	layer.ReleaseChannels()
+	assert.Nil(t, layer.ChannelData)
+
+	data, err := layer.Channel(0)
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+	assert.NotNil(t, layer.ChannelData)
+}
+
+func TestLazyChannelsRender(t *testing.T) {
+	eager, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer eager.Close()
+	require.NoError(t, eager.Parse())
+
+	lazy, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer lazy.Close()
+	require.NoError(t, lazy.ParseWithOptions(ParseOptions{LazyChannels: true}))
+
+	want, err := NewRenderer(eager.Tree()).Render()
+	require.NoError(t, err)
+
+	got, err := NewRendererWithOptions(lazy.Tree(), RendererOptions{ReleaseChannels: true}).Render()
+	require.NoError(t, err)
+	assert.Equal(t, want.Pix, got.Pix)
+
+	for _, layer := range lazy.Layers() {
+		assert.Nil(t, layer.ChannelData)
+	}
+}
+
+func TestParseOptionsSkipSections(t *testing.T) {
+	full, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer full.Close()
+	require.NoError(t, full.Parse())
+
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{SkipLayers: true, SkipImage: true}))
+
+	assert.True(t, psd.Parsed())
+	assert.NotNil(t, psd.resources.loaded())
+	assert.Nil(t, psd.layerMask.loaded())
+	assert.Nil(t, psd.image.loaded())
+	assert.Equal(t, len(full.Resources().Resources), len(psd.Resources().Resources))
+
+	// Skipped sections are parsed on access, in any order
+	assert.Equal(t, full.Image().PixelData(), psd.Image().PixelData())
+	require.Equal(t, len(full.Layers()), len(psd.Layers()))
+	for i, layer := range psd.Layers() {
+		assert.Equal(t, full.Layers()[i].Name, layer.Name)
+		assert.Equal(t, full.Layers()[i].ChannelData, layer.ChannelData)
+	}
+}
+
+func TestParseOptionsImageOnly(t *testing.T) {
+	full, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer full.Close()
+	require.NoError(t, full.Parse())
+
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{SkipResources: true, SkipLayers: true}))
+
+	assert.Nil(t, psd.resources.loaded())
+	assert.Nil(t, psd.layerMask.loaded())
+	assert.Equal(t, full.Image().PixelData(), psd.Image().PixelData())
+
+	guides, err := psd.Guides()
+	require.NoError(t, err)
+	fullGuides, err := full.Guides()
+	require.NoError(t, err)
+	assert.Equal(t, fullGuides, guides)
+}
+
+func TestParseOptionsSkipSectionsPSB(t *testing.T) {
+	psd, err := New("testdata/example.psb")
+	require.NoError(t, err)
+	defer psd.Close()
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{SkipResources: true, SkipLayers: true}))
+
+	ref, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer ref.Close()
+
+	assert.Equal(t, ref.Image().PixelData(), psd.Image().PixelData())
+	assert.Equal(t, len(ref.Layers()), len(psd.Layers()))
+}
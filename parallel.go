@@ -0,0 +1,49 @@
+package psd
+
+import (
+	"runtime"
+	"sync"
+)
+
+// concurrency returns the number of goroutines that may decode channels
+func (s *parseState) concurrency() int {
+	if s == nil || s.opts.Concurrency == 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	if s.opts.Concurrency < 1 {
+		return 1
+	}
+	return s.opts.Concurrency
+}
+
+// forEach calls fn for every index in [0, n) using at most workers
+// goroutines. Callers store results by index, so the outcome does not depend
+// on scheduling.
+func forEach(workers, n int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
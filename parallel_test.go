@@ -0,0 +1,90 @@
+package psd
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseWithConcurrency(t *testing.T, path string, concurrency int) *PSD {
+	psd, err := New(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { psd.Close() })
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{Concurrency: concurrency}))
+	return psd
+}
+
+func TestConcurrencyDeterministic(t *testing.T) {
+	for _, name := range []string{"example.psd", "example.psb", "blendmodes.psd", "empty-layer.psd"} {
+		t.Run(name, func(t *testing.T) {
+			serial := parseWithConcurrency(t, "testdata/"+name, 1)
+			parallel := parseWithConcurrency(t, "testdata/"+name, 8)
+
+			serialLayers := serial.Layers()
+			parallelLayers := parallel.Layers()
+			require.Equal(t, len(serialLayers), len(parallelLayers))
+			for i := range serialLayers {
+				assert.Equal(t, serialLayers[i].ChannelData, parallelLayers[i].ChannelData, "layer %d", i)
+			}
+
+			assert.Equal(t, serial.Image().channelData, parallel.Image().channelData)
+			assert.Equal(t, serial.Image().PixelData(), parallel.Image().PixelData())
+		})
+	}
+}
+
+func TestConcurrencyWarnings(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[0].channels[2].compression = 9
+	doc.layers[1].channels[0].compression = 8
+	data := doc.build()
+
+	var want []*ParseError
+	for _, concurrency := range []int{1, 2, 8} {
+		psd, err := NewFromBytes(data)
+		require.NoError(t, err)
+		require.NoError(t, psd.ParseWithOptions(ParseOptions{Lenient: true, Concurrency: concurrency}))
+
+		warnings := psd.Warnings()
+		require.Len(t, warnings, 2)
+		assert.Equal(t, 0, warnings[0].Layer)
+		assert.Equal(t, 1, warnings[1].Layer)
+		if want == nil {
+			want = warnings
+		}
+		assert.Equal(t, want, warnings, "concurrency %d", concurrency)
+	}
+}
+
+func TestConcurrencyReleasesBudget(t *testing.T) {
+	doc := errorDoc()
+	doc.layers[0].channels[1].compression = 9
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.ErrorIs(t, psd.ParseWithOptions(ParseOptions{Concurrency: 4, SkipImage: true}), ErrUnsupportedCompression)
+	assert.Zero(t, psd.state.budget.used.Load())
+}
+
+func TestForEach(t *testing.T) {
+	var running, peak atomic.Int32
+	results := make([]int, 100)
+	forEach(3, len(results), func(i int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		results[i] = i * i
+		running.Add(-1)
+	})
+
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	for i, v := range results {
+		assert.Equal(t, i*i, v)
+	}
+}
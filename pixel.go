@@ -0,0 +1,381 @@
+package psd
+
+import (
+	"encoding/binary"
+	"image/color"
+	"math"
+)
+
+// ToneMapper maps a linear 32-bit floating point sample to a display
+// encoded value in the range [0, 1]
+type ToneMapper func(v float32) float32
+
+// ToneMapClamp clamps linear values to [0, 1] and applies the sRGB transfer
+// curve. It is the default tone mapping for 32-bit documents.
+func ToneMapClamp(v float32) float32 {
+	return float32(linearToSRGB(clamp01(float64(v))))
+}
+
+// ToneMapReinhard compresses highlights with the Reinhard operator
+// v / (1 + v) before applying the sRGB transfer curve
+func ToneMapReinhard(v float32) float32 {
+	if v < 0 {
+		v = 0
+	}
+	return float32(linearToSRGB(float64(v / (1 + v))))
+}
+
+// ToneMapExposure returns a ToneMapper that scales linear values by
+// 2^stops, clamps them and applies the sRGB transfer curve
+func ToneMapExposure(stops float64) ToneMapper {
+	scale := float32(math.Pow(2, stops))
+	return func(v float32) float32 {
+		return ToneMapClamp(v * scale)
+	}
+}
+
+// CMYKConverter converts ink coverage in [0, 1] (0 = no ink) to RGB in
+// [0, 1]. Set one in ColorOptions to plug in profile-based conversion.
+type CMYKConverter func(c, m, y, k float64) (r, g, b float64)
+
+// NaiveCMYKToRGB converts CMYK to RGB with the device-independent formula
+// r = (1 - c) * (1 - k). It is the default CMYKConverter.
+func NaiveCMYKToRGB(c, m, y, k float64) (r, g, b float64) {
+	return (1 - c) * (1 - k), (1 - m) * (1 - k), (1 - y) * (1 - k)
+}
+
+// ColorOptions controls how decoded samples are converted to display colours
+type ColorOptions struct {
+	// ToneMapper converts 32-bit linear samples for display. Defaults to
+	// ToneMapClamp.
+	ToneMapper ToneMapper
+
+	// CMYKConverter converts CMYK documents to RGB. Defaults to
+	// NaiveCMYKToRGB.
+	CMYKConverter CMYKConverter
+
+	// Profile converts RGB, CMYK, Grayscale and Indexed colours to sRGB,
+	// taking precedence over CMYKConverter. Set it to PSD.ICCProfile to
+	// colour manage with the embedded profile. It is ignored if its colour
+	// space does not match the document or it cannot convert colours, and
+	// for 1 and 32-bit documents.
+	Profile *ICCProfile
+}
+
+func (o *ColorOptions) toneMapper() ToneMapper {
+	if o == nil || o.ToneMapper == nil {
+		return ToneMapClamp
+	}
+	return o.ToneMapper
+}
+
+// profile returns the profile converting colours of documents with header,
+// or nil
+func (o *ColorOptions) profile(header *Header) *ICCProfile {
+	if o == nil || !o.Profile.CanConvert() || header.Depth == 1 || header.Depth == 32 {
+		return nil
+	}
+	var space string
+	switch {
+	case header.IsRGB(), header.IsIndexed():
+		space = ICCColorSpaceRGB
+	case header.IsCMYK():
+		space = ICCColorSpaceCMYK
+	case header.IsGrayscale():
+		space = ICCColorSpaceGray
+	}
+	if o.Profile.Header.ColorSpace != space {
+		return nil
+	}
+	return o.Profile
+}
+
+func (o *ColorOptions) cmykConverter() CMYKConverter {
+	if o == nil || o.CMYKConverter == nil {
+		return NaiveCMYKToRGB
+	}
+	return o.CMYKConverter
+}
+
+// pixelConverter converts planar channel samples to colours. Colour planes
+// are given in document channel order; a nil or short plane reads as 0 and a
+// missing alpha plane reads as fully opaque.
+type pixelConverter struct {
+	header  *Header
+	colors  *ColorOptions
+	width   int
+	planes  [][]byte
+	alpha   []byte
+	matte   bool // colour is composited over white and must be unmatted
+	tone    ToneMapper
+	cmyk    CMYKConverter
+	profile *ICCProfile
+	palette color.Palette
+}
+
+func newPixelConverter(header *Header, colors *ColorOptions, width int, planes [][]byte, alpha []byte) *pixelConverter {
+	return &pixelConverter{
+		header:  header,
+		colors:  colors,
+		width:   width,
+		planes:  planes,
+		alpha:   alpha,
+		tone:    colors.toneMapper(),
+		cmyk:    colors.cmykConverter(),
+		profile: colors.profile(header),
+		palette: header.Palette(),
+	}
+}
+
+// sample returns the i-th sample of plane scaled to [0, 1]. 32-bit samples
+// are passed through the tone mapper unless raw is set.
+func (pc *pixelConverter) sample(plane []byte, i int, raw bool) (float64, bool) {
+	switch pc.header.Depth {
+	case 1:
+		// Rows are padded to whole bytes; a set bit is black
+		x, y := i%pc.width, i/pc.width
+		idx := y*pc.header.BytesPerRow(pc.width) + x/8
+		if idx >= len(plane) {
+			return 0, false
+		}
+		return float64(1 - (plane[idx]>>(7-uint(x%8)))&1), true
+	case 16:
+		if (i+1)*2 > len(plane) {
+			return 0, false
+		}
+		return float64(binary.BigEndian.Uint16(plane[i*2:])) / 65535, true
+	case 32:
+		if (i+1)*4 > len(plane) {
+			return 0, false
+		}
+		v := math.Float32frombits(binary.BigEndian.Uint32(plane[i*4:]))
+		if raw {
+			return clamp01(float64(v)), true
+		}
+		return clamp01(float64(pc.tone(v))), true
+	default:
+		if i >= len(plane) {
+			return 0, false
+		}
+		return float64(plane[i]) / 255, true
+	}
+}
+
+// colorSample returns the i-th sample of colour plane ch
+func (pc *pixelConverter) colorSample(ch, i int) float64 {
+	if ch >= len(pc.planes) {
+		return 0
+	}
+	v, _ := pc.sample(pc.planes[ch], i, false)
+	return v
+}
+
+// at returns the straight (non-premultiplied) colour of pixel i in [0, 1]
+func (pc *pixelConverter) at(i int) (r, g, b, a float64) {
+	a = 1
+	if pc.alpha != nil {
+		if v, ok := pc.sample(pc.alpha, i, true); ok {
+			a = v
+		}
+	}
+
+	r, g, b = pc.color(i)
+	if pc.matte && a > 0 && a < 1 {
+		// The merged composite is flattened onto white: c = s*a + (1 - a)
+		r, g, b = unmatte(r, a), unmatte(g, a), unmatte(b, a)
+	}
+	return r, g, b, a
+}
+
+// unmatte removes a white matte from a colour composited with alpha a
+func unmatte(c, a float64) float64 {
+	return clamp01((c + a - 1) / a)
+}
+
+// color returns the colour of pixel i in [0, 1], ignoring alpha
+func (pc *pixelConverter) color(i int) (r, g, b float64) {
+	if pc.profile != nil {
+		if r, g, b, ok := pc.managedColor(i); ok {
+			return r, g, b
+		}
+	}
+	if pc.palette != nil && len(pc.planes) == 1 {
+		if i < len(pc.planes[0]) {
+			r, g, b, _ := pc.palette[pc.planes[0][i]].RGBA()
+			return float64(r) / 65535, float64(g) / 65535, float64(b) / 65535
+		}
+		return 0, 0, 0
+	}
+
+	if len(pc.planes) == 1 {
+		gray := pc.colorSample(0, i)
+		return gray, gray, gray
+	}
+
+	if pc.header.IsLab() && len(pc.planes) >= 3 {
+		r, g, b = labToSRGB(
+			pc.colorSample(0, i)*100,
+			pc.colorSample(1, i)*255-128,
+			pc.colorSample(2, i)*255-128,
+		)
+		return r, g, b
+	}
+
+	if pc.header.IsMultichannel() {
+		// Multichannel plates are ink channels stored inverted like CMYK;
+		// the first four are shown as cyan, magenta, yellow and black
+		var ink [4]float64
+		for ch := 0; ch < len(pc.planes) && ch < 4; ch++ {
+			ink[ch] = 1 - pc.colorSample(ch, i)
+		}
+		r, g, b = pc.cmyk(ink[0], ink[1], ink[2], ink[3])
+		return clamp01(r), clamp01(g), clamp01(b)
+	}
+
+	if pc.header.IsCMYK() && len(pc.planes) >= 4 {
+		// CMYK samples are stored inverted: 0 means full ink coverage
+		r, g, b = pc.cmyk(
+			1-pc.colorSample(0, i),
+			1-pc.colorSample(1, i),
+			1-pc.colorSample(2, i),
+			1-pc.colorSample(3, i),
+		)
+		return clamp01(r), clamp01(g), clamp01(b)
+	}
+
+	return pc.colorSample(0, i), pc.colorSample(1, i), pc.colorSample(2, i)
+}
+
+// managedColor converts pixel i to sRGB through the colour profile
+func (pc *pixelConverter) managedColor(i int) (r, g, b float64, ok bool) {
+	var in [4]float64
+	switch {
+	case pc.palette != nil && len(pc.planes) == 1:
+		if i >= len(pc.planes[0]) {
+			return 0, 0, 0, false
+		}
+		cr, cg, cb, _ := pc.palette[pc.planes[0][i]].RGBA()
+		in[0], in[1], in[2] = float64(cr)/65535, float64(cg)/65535, float64(cb)/65535
+	case pc.header.IsCMYK():
+		// ICC CMYK values are ink coverage; samples are stored inverted
+		for ch := range in {
+			in[ch] = 1 - pc.colorSample(ch, i)
+		}
+	default:
+		for ch := range in {
+			in[ch] = pc.colorSample(ch, i)
+		}
+	}
+	return pc.profile.ToSRGB(in[:])
+}
+
+// rgba8 returns pixel i down-converted to 8 bits per channel. Like
+// Layer.ToImage, the colour is not premultiplied by alpha.
+func (pc *pixelConverter) rgba8(i int) color.RGBA {
+	r, g, b, a := pc.at(i)
+	return color.RGBA{R: to8(r), G: to8(g), B: to8(b), A: to8(a)}
+}
+
+// nrgba64 returns pixel i with 16 bits per channel
+func (pc *pixelConverter) nrgba64(i int) color.NRGBA64 {
+	r, g, b, a := pc.at(i)
+	return color.NRGBA64{R: to16(r), G: to16(g), B: to16(b), A: to16(a)}
+}
+
+func to8(v float64) uint8 {
+	return uint8(clamp01(v)*255 + 0.5)
+}
+
+func to16(v float64) uint16 {
+	return uint16(clamp01(v)*65535 + 0.5)
+}
+
+// D50 reference white used by Photoshop's Lab mode
+const (
+	labWhiteX = 0.96422
+	labWhiteY = 1.0
+	labWhiteZ = 0.82521
+)
+
+// labToSRGB converts a D50 Lab colour to display encoded sRGB in [0, 1]
+func labToSRGB(l, a, b float64) (float64, float64, float64) {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+
+	x := labWhiteX * labFInv(fx)
+	y := labWhiteY * labFInv(fy)
+	z := labWhiteZ * labFInv(fz)
+
+	return xyzD50ToSRGB(x, y, z)
+}
+
+func labFInv(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta {
+		return t * t * t
+	}
+	return 3 * delta * delta * (t - 4.0/29.0)
+}
+
+// xyzD50ToSRGB converts D50 XYZ to display encoded sRGB in [0, 1] using the
+// Bradford-adapted D50 to sRGB (D65) matrix
+func xyzD50ToSRGB(x, y, z float64) (float64, float64, float64) {
+	r := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	g := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	b := 0.0719453*x - 0.2289914*y + 1.4052427*z
+	return linearToSRGB(clamp01(r)), linearToSRGB(clamp01(g)), linearToSRGB(clamp01(b))
+}
+
+// clamp01 clamps a value between 0 and 1
+func clamp01(v float64) float64 {
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// linearToSRGB applies the sRGB transfer curve to a linear value in [0, 1]
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// sample8 returns the i-th sample of a plane width samples wide at the given
+// bit depth down-converted to 8 bits, without tone mapping. It is used for
+// masks and extra channels.
+func sample8(plane []byte, i, width int, depth uint16) (uint8, bool) {
+	switch depth {
+	case 1:
+		// Rows are padded to whole bytes; a set bit is black
+		x, y := i%width, i/width
+		idx := y*((width+7)/8) + x/8
+		if idx >= len(plane) {
+			return 0, false
+		}
+		if (plane[idx]>>(7-uint(x%8)))&1 != 0 {
+			return 0, true
+		}
+		return 255, true
+	case 16:
+		if (i+1)*2 > len(plane) {
+			return 0, false
+		}
+		return uint8(binary.BigEndian.Uint16(plane[i*2:]) >> 8), true
+	case 32:
+		if (i+1)*4 > len(plane) {
+			return 0, false
+		}
+		return to8(float64(math.Float32frombits(binary.BigEndian.Uint32(plane[i*4:])))), true
+	default:
+		if i >= len(plane) {
+			return 0, false
+		}
+		return plane[i], true
+	}
+}
@@ -0,0 +1,114 @@
+package psd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// psbGradient returns width*height samples forming a horizontal gradient
+func psbGradient(width, height int, offset byte) []byte {
+	data := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			data[y*width+x] = byte(x) + offset
+		}
+	}
+	return data
+}
+
+func TestParsePSB(t *testing.T) {
+	const width, height = 300, 4
+
+	doc := &testDoc{
+		version:  2,
+		channels: 3,
+		width:    width,
+		height:   height,
+		depth:    8,
+		mode:     ColorModeRGBColor,
+		layers: []testLayer{
+			{
+				name: "Raw", top: 0, left: 0, bottom: 2, right: 3, opacity: 255,
+				channels: []testChannel{
+					{id: -1, compression: 0, data: fill(255, 6)},
+					{id: 0, compression: 0, data: fill(10, 6)},
+					{id: 1, compression: 0, data: fill(20, 6)},
+					{id: 2, compression: 0, data: fill(30, 6)},
+				},
+			},
+			{
+				name: "RLE", top: 0, left: 0, bottom: height, right: width, opacity: 128,
+				channels: []testChannel{
+					{id: -1, compression: 1, data: fill(255, width*height)},
+					{id: 0, compression: 1, data: psbGradient(width, height, 0)},
+					{id: 1, compression: 1, data: fill(7, width*height)},
+					{id: 2, compression: 1, data: psbGradient(width, height, 50)},
+				},
+				info: []testInfo{
+					{key: "lyid", data: []byte{0, 0, 0, 9}},
+					{key: "Mtrn", data: []byte{1, 2, 3, 4}},
+				},
+			},
+		},
+		composite: [][]byte{
+			psbGradient(width, height, 0),
+			fill(7, width*height),
+			psbGradient(width, height, 50),
+		},
+		compositeCompression: 1,
+	}
+
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	assert.True(t, psd.Header().IsBig())
+
+	layers := psd.Layers()
+	require.Len(t, layers, 2)
+	assert.Equal(t, "RLE", layers[0].Name)
+	assert.Equal(t, "Raw", layers[1].Name)
+	assert.Equal(t, int32(9), layers[0].GetLayerID())
+	assert.Equal(t, []byte{1, 2, 3, 4}, layers[0].LayerInfo["Mtrn"])
+
+	assert.Equal(t, psbGradient(width, height, 0), layers[0].ChannelData[0])
+	assert.Equal(t, psbGradient(width, height, 50), layers[0].ChannelData[2])
+	assert.Equal(t, fill(20, 6), layers[1].ChannelData[1])
+
+	pixels := psd.Image().PixelData()
+	require.Len(t, pixels, width*height)
+	assert.Equal(t, uint8(299%256), pixels[width-1].R)
+	assert.Equal(t, uint8(7), pixels[width-1].G)
+	assert.Equal(t, uint8((299+50)%256), pixels[width-1].B)
+}
+
+func TestParsePSBFixture(t *testing.T) {
+	psdDoc, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psdDoc.Close()
+	require.NoError(t, psdDoc.Parse())
+
+	psbDoc, err := New("testdata/example.psb")
+	require.NoError(t, err)
+	defer psbDoc.Close()
+	require.NoError(t, psbDoc.Parse())
+
+	assert.Equal(t, uint16(2), psbDoc.Header().Version)
+	assert.Equal(t, psdDoc.Header().Width(), psbDoc.Header().Width())
+	assert.Equal(t, psdDoc.Header().Height(), psbDoc.Header().Height())
+
+	psdLayers := psdDoc.Layers()
+	psbLayers := psbDoc.Layers()
+	require.Equal(t, len(psdLayers), len(psbLayers))
+	for i := range psdLayers {
+		assert.Equal(t, psdLayers[i].Name, psbLayers[i].Name)
+		assert.Equal(t, psdLayers[i].Left, psbLayers[i].Left)
+		assert.Equal(t, psdLayers[i].Top, psbLayers[i].Top)
+		assert.Equal(t, psdLayers[i].ChannelData, psbLayers[i].ChannelData, "layer %d", i)
+	}
+
+	assert.Equal(t, psdDoc.Tree().ToHash(), psbDoc.Tree().ToHash())
+	assert.Equal(t, psdDoc.Image().PixelData(), psbDoc.Image().PixelData())
+}
@@ -1,20 +1,73 @@
 package psd
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
-// PSD represents a Photoshop document
+// PSD represents a Photoshop document. Once configured with ParseWithOptions
+// and SetColorOptions, its accessors may be called from several goroutines:
+// each section is parsed once through its own cursor into the file, and
+// lazily decoded layer channels are read with positional reads.
 type PSD struct {
-	file      *File
-	header    *Header
-	resources *ResourceSection
-	layerMask *LayerMask
-	image     *Image
-	parsed    bool
+	file   *File
+	colors ColorOptions
+	state  parseState
+	parsed atomic.Bool
+
+	header    lazySection[Header]
+	resources lazySection[ResourceSection]
+	layerMask lazySection[LayerMask]
+	image     lazySection[Image]
+
+	// Section offsets, located from the length prefixes after the header.
+	// They are written with the header and read after it is loaded.
+	resourcesPos int64
+	layerMaskPos int64
+	imagePos     int64
+
+	// layerMaskErr is set if the layer and mask section length cannot be
+	// read. It fails the layer and image sections but not the resources.
+	layerMaskErr error
+}
+
+// lazySection holds a section parsed on first use. Like sync.Once,
+// concurrent callers wait for a single parse; unlike it, a parse that failed
+// or was cancelled is tried again by the next caller.
+type lazySection[T any] struct {
+	mu    sync.Mutex
+	value *T
+}
+
+// get returns the section, calling parse if it has not been parsed yet
+func (s *lazySection[T]) get(parse func() (*T, error)) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.value != nil {
+		return s.value, nil
+	}
+	value, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	s.value = value
+	return value, nil
+}
+
+// loaded returns the section if it has been parsed, without parsing it
+func (s *lazySection[T]) loaded() *T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
 }
 
 // New creates a new PSD instance from a file path
@@ -24,15 +77,58 @@ func New(filename string) (*PSD, error) {
 		return nil, err
 	}
 
-	file := &File{
-		file:   f,
-		reader: f,
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &PSD{file: newFile(f, info.Size(), f)}, nil
+}
+
+// NewFromReaderAt creates a new PSD instance reading from r, which must
+// provide size bytes. The caller keeps ownership of r; Close does not close it.
+// Concurrent use of the PSD requires r to support concurrent ReadAt calls.
+func NewFromReaderAt(r io.ReaderAt, size int64) (*PSD, error) {
+	if r == nil {
+		return nil, fmt.Errorf("nil reader")
 	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size: %d", size)
+	}
+
+	return &PSD{file: newFile(r, size, nil)}, nil
+}
 
-	return &PSD{
-		file:   file,
-		parsed: false,
-	}, nil
+// NewFromBytes creates a new PSD instance from an in-memory document
+func NewFromBytes(data []byte) (*PSD, error) {
+	return &PSD{file: newFileFromBytes(data)}, nil
+}
+
+// NewFromFS creates a new PSD instance from a file in fsys, such as an
+// embed.FS. Files that do not implement io.ReaderAt are read into memory.
+func NewFromFS(fsys fs.FS, name string) (*PSD, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		return &PSD{file: newFile(ra, info.Size(), f)}, nil
+	}
+
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromBytes(data)
 }
 
 // Open opens a PSD file, parses it, and executes the provided function
@@ -50,291 +146,624 @@ func Open(filename string, fn func(*PSD) error) error {
 	return fn(psd)
 }
 
+// OpenFS opens a PSD file from fsys, parses it, and executes the provided function
+func OpenFS(fsys fs.FS, name string, fn func(*PSD) error) error {
+	psd, err := NewFromFS(fsys, name)
+	if err != nil {
+		return err
+	}
+	defer psd.Close()
+
+	if err := psd.Parse(); err != nil {
+		return err
+	}
+
+	return fn(psd)
+}
+
 // Close closes the underlying file
 func (p *PSD) Close() error {
-	if p.file != nil && p.file.file != nil {
-		return p.file.file.Close()
+	if p.file != nil {
+		return p.file.Close()
 	}
 	return nil
 }
 
-// Parse parses all sections of the PSD file
+// Parse parses all sections of the PSD file, except those skipped by the
+// options given to ParseWithOptions
 func (p *PSD) Parse() error {
-	if err := p.parseHeader(); err != nil {
-		return fmt.Errorf("failed to parse header: %w", err)
+	return p.parse(context.Background())
+}
+
+// ParseContext parses the PSD file like Parse, stopping when ctx is done.
+// Cancellation is checked between resources, layers, channels and
+// scanlines; it returns ctx.Err() and keeps only the sections parsed
+// completely, so the others are parsed again on next access.
+func (p *PSD) ParseContext(ctx context.Context) error {
+	err := p.parse(ctx)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
 	}
+	return err
+}
 
-	if err := p.parseResources(); err != nil {
-		return fmt.Errorf("failed to parse resources: %w", err)
+func (p *PSD) parse(ctx context.Context) error {
+	if _, err := p.parseHeader(); err != nil {
+		return err
 	}
 
-	if err := p.parseLayerMask(); err != nil {
-		return fmt.Errorf("failed to parse layer mask: %w", err)
+	if !p.state.opts.SkipResources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := p.parseResources(ctx); err != nil {
+			return err
+		}
 	}
 
-	if err := p.parseImage(); err != nil {
-		return fmt.Errorf("failed to parse image: %w", err)
+	if !p.state.opts.SkipLayers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := p.parseLayerMask(ctx); err != nil {
+			return err
+		}
 	}
 
-	p.parsed = true
+	if !p.state.opts.SkipImage {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := p.parseImage(ctx); err != nil {
+			return err
+		}
+	}
+
+	p.parsed.Store(true)
 	return nil
 }
 
+// SetColorOptions sets how decoded samples are converted to display
+// colours by Image, Layer.ToImage and the renderer. It must not be called
+// while other goroutines use the PSD.
+func (p *PSD) SetColorOptions(opts ColorOptions) {
+	p.colors = opts
+}
+
+// ParseWithOptions parses the PSD file using opts. Skipped sections are
+// parsed on first access through Resources, Layers, Tree or Image. It must
+// not be called while other goroutines use the PSD.
+func (p *PSD) ParseWithOptions(opts ParseOptions) error {
+	p.state.opts = opts
+	return p.Parse()
+}
+
+// ParseWithOptionsContext parses the PSD file using opts, stopping when ctx
+// is done like ParseContext
+func (p *PSD) ParseWithOptionsContext(ctx context.Context, opts ParseOptions) error {
+	p.state.opts = opts
+	return p.ParseContext(ctx)
+}
+
+// Warnings returns the errors recovered from when parsing with
+// ParseOptions.Lenient. Lazily decoded layer channels may add to them.
+func (p *PSD) Warnings() []*ParseError {
+	return p.state.warningList()
+}
+
 // Parsed returns whether the PSD has been parsed
 func (p *PSD) Parsed() bool {
-	return p.parsed
+	return p.parsed.Load()
 }
 
 // Header returns the PSD header
 func (p *PSD) Header() *Header {
-	if p.header == nil {
-		p.parseHeader()
-	}
-	return p.header
+	header, _ := p.parseHeader()
+	return header
 }
 
 // Resources returns the resource section
 func (p *PSD) Resources() *ResourceSection {
-	if p.resources == nil {
-		p.parseResources()
-	}
-	return p.resources
+	resources, _ := p.parseResources(context.Background())
+	return resources
 }
 
 // LayerMask returns the layer mask section
 func (p *PSD) LayerMask() *LayerMask {
-	if p.layerMask == nil {
-		p.parseLayerMask()
-	}
-	return p.layerMask
+	layerMask, _ := p.parseLayerMask(context.Background())
+	return layerMask
 }
 
 // Image returns the flattened image
 func (p *PSD) Image() *Image {
-	if p.image == nil {
-		p.parseImage()
-	}
-	return p.image
+	image, _ := p.parseImage(context.Background())
+	return image
 }
 
-// Layers returns all layers
+// Layers returns all layers, or nil if the layer section cannot be parsed
 func (p *PSD) Layers() []*Layer {
-	if p.layerMask == nil {
-		p.parseLayerMask()
+	layerMask := p.LayerMask()
+	if layerMask == nil {
+		return nil
 	}
-	return p.layerMask.Layers
+	return layerMask.Layers
 }
 
-// Tree returns the layer tree structure
+// Tree returns the layer tree structure, or nil if the layer section cannot
+// be parsed
 func (p *PSD) Tree() *Node {
-	if p.layerMask == nil {
-		p.parseLayerMask()
+	layerMask := p.LayerMask()
+	if layerMask == nil {
+		return nil
 	}
-	return p.layerMask.Tree()
+	return layerMask.Tree()
 }
 
 // LayerComps returns all layer comps
 func (p *PSD) LayerComps() []LayerComp {
-	if p.resources == nil {
-		p.parseResources()
+	resources := p.Resources()
+	if resources == nil {
+		return nil
 	}
-	return p.resources.LayerComps()
+	return resources.LayerComps()
 }
 
 // Slices returns all slices
 func (p *PSD) Slices() (*SlicesResource, error) {
-	if p.resources == nil {
-		if err := p.parseResources(); err != nil {
-			return nil, err
-		}
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
 	}
-	return p.resources.ParseSlices()
+	return resources.ParseSlices()
 }
 
 // Guides returns all guides
 func (p *PSD) Guides() (*GuidesResource, error) {
-	if p.resources == nil {
-		if err := p.parseResources(); err != nil {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseGuides()
+}
+
+func (p *PSD) parseHeader() (*Header, error) {
+	return p.header.get(func() (*Header, error) {
+		file := p.file.cursor(0)
+		header := &Header{file: file, state: &p.state}
+		if err := header.Parse(); err != nil {
+			return nil, newParseError(SectionHeader, -1, "", 0, err)
+		}
+
+		if err := p.locateSections(file, header); err != nil {
 			return nil, err
 		}
-	}
-	return p.resources.ParseGuides()
+		return header, nil
+	})
 }
 
-func (p *PSD) parseHeader() error {
-	if p.header != nil {
-		return nil
+// locateSections records where the resources, layer and mask, and image
+// data sections start, so each can be parsed without reading the others. A
+// damaged layer and mask length is recorded in layerMaskErr, so the header
+// and resources stay readable.
+func (p *PSD) locateSections(file *File, header *Header) error {
+	pos, err := file.Tell()
+	if err != nil {
+		return err
 	}
+	p.resourcesPos = pos
 
-	header := &Header{file: p.file}
-	if err := header.Parse(); err != nil {
-		return err
+	resourcesLength, err := file.ReadUint32()
+	if err != nil {
+		return newParseError(SectionResources, -1, "", p.resourcesPos, fmt.Errorf("failed to read resources length: %w", err))
 	}
+	p.layerMaskPos = p.resourcesPos + 4 + int64(resourcesLength)
+
+	if _, err := file.Seek(p.layerMaskPos, io.SeekStart); err != nil {
+		p.layerMaskErr = newParseError(SectionLayers, -1, "", p.layerMaskPos, err)
+		return nil
+	}
+	layerMaskLength, err := file.ReadLength(header.IsBig())
+	if err != nil {
+		p.layerMaskErr = newParseError(SectionLayers, -1, "", p.layerMaskPos, fmt.Errorf("failed to read layer mask length: %w", err))
+		return nil
+	}
+	p.imagePos = p.layerMaskPos + int64(header.LengthSize()) + int64(layerMaskLength)
 
-	p.header = header
 	return nil
 }
 
-func (p *PSD) parseResources() error {
-	if p.resources != nil {
-		return nil
+func (p *PSD) parseResources(ctx context.Context) (*ResourceSection, error) {
+	if _, err := p.parseHeader(); err != nil {
+		return nil, err
 	}
 
-	if p.header == nil {
-		if err := p.parseHeader(); err != nil {
-			return err
+	return p.resources.get(func() (*ResourceSection, error) {
+		resources := &ResourceSection{file: p.file.cursor(p.resourcesPos), state: &p.state}
+		if err := resources.parse(ctx); err != nil {
+			return nil, newParseError(SectionResources, -1, "", p.resourcesPos, err)
 		}
+		return resources, nil
+	})
+}
+
+func (p *PSD) parseLayerMask(ctx context.Context) (*LayerMask, error) {
+	header, err := p.parseHeader()
+	if err != nil {
+		return nil, err
+	}
+	if p.layerMaskErr != nil {
+		return nil, p.layerMaskErr
 	}
 
-	resources := &ResourceSection{file: p.file}
-	if err := resources.Parse(); err != nil {
-		return err
+	return p.layerMask.get(func() (*LayerMask, error) {
+		layerMask := &LayerMask{file: p.file.cursor(p.layerMaskPos), header: header, colors: &p.colors, state: &p.state, psd: p}
+		if err := layerMask.parse(ctx); err != nil {
+			return nil, newParseError(SectionLayers, -1, "", p.layerMaskPos, err)
+		}
+		return layerMask, nil
+	})
+}
+
+func (p *PSD) parseImage(ctx context.Context) (*Image, error) {
+	header, err := p.parseHeader()
+	if err != nil {
+		return nil, err
 	}
+	if p.layerMaskErr != nil {
+		return nil, p.layerMaskErr
+	}
+
+	return p.image.get(func() (*Image, error) {
+		image := &Image{file: p.file.cursor(p.imagePos), header: header, colors: &p.colors, state: &p.state}
+		image.mergedAlpha = p.mergedAlpha(header)
+		if err := image.parse(ctx); err != nil {
+			err = newParseError(SectionImage, -1, "", p.imagePos, err)
+			if !p.state.recover(err) {
+				return nil, err
+			}
+			// Keep the empty image rather than decoding it again on access
+			image.parsed = true
+			if image.pixelData == nil {
+				image.width, image.height = 0, 0
+			}
+		}
+		return image, nil
+	})
+}
 
-	p.resources = resources
-	return nil
+// mergedAlpha reports whether the composite image has a transparency
+// channel. The layer count is read without parsing the layers unless they
+// are already parsed; an unreadable count means no transparency.
+func (p *PSD) mergedAlpha(header *Header) bool {
+	if layerMask := p.layerMask.loaded(); layerMask != nil {
+		return layerMask.MergedAlpha()
+	}
+	count, err := readLayerCount(p.file.cursor(p.layerMaskPos), header)
+	return err == nil && count < 0
 }
 
-func (p *PSD) parseLayerMask() error {
-	if p.layerMask != nil {
-		return nil
+// fileBufferSize is the size of the read buffer of a File. Sections are
+// parsed front to back, so one buffer covers many small reads.
+const fileBufferSize = 32 << 10
+
+// File is a seekable binary reader over the document bytes. Every section
+// parser reads through a File, so the source may be an *os.File, an
+// in-memory buffer or any other io.ReaderAt. Reads are served from an
+// internal buffer and the integer readers do not allocate.
+type File struct {
+	r      io.ReaderAt
+	size   int64
+	pos    int64
+	closer io.Closer
+
+	// buf holds the bytes at offsets [bufStart, bufStart+len(buf)). For
+	// in-memory documents it is the whole document and is never refilled.
+	buf      []byte
+	bufStart int64
+	fixed    bool
+}
+
+// newFile creates a File reading size bytes from r. closer, if not nil,
+// is closed by Close.
+func newFile(r io.ReaderAt, size int64, closer io.Closer) *File {
+	return &File{
+		r:      r,
+		size:   size,
+		closer: closer,
 	}
+}
 
-	if p.header == nil {
-		if err := p.parseHeader(); err != nil {
-			return err
-		}
+// newFileFromBytes creates a File reading directly from data
+func newFileFromBytes(data []byte) *File {
+	return &File{
+		r:     bytes.NewReader(data),
+		size:  int64(len(data)),
+		buf:   data,
+		fixed: true,
 	}
+}
 
-	if p.resources == nil {
-		if err := p.parseResources(); err != nil {
-			return err
-		}
+// cursor returns a File reading the same document from offset with its own
+// position and buffer. Sections are parsed through separate cursors, so they
+// can be parsed from different goroutines.
+func (f *File) cursor(offset int64) *File {
+	c := &File{r: f.r, size: f.size, pos: offset}
+	if f.fixed {
+		c.buf, c.fixed = f.buf, true
 	}
+	return c
+}
 
-	layerMask := &LayerMask{file: p.file, header: p.header}
-	if err := layerMask.Parse(); err != nil {
-		return err
+// ReadAt reads len(p) bytes at off without moving the position. It is safe
+// for concurrent use if the underlying io.ReaderAt is, as *os.File and
+// in-memory documents are.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+	if f.fixed {
+		if off >= int64(len(f.buf)) {
+			return 0, errTruncatedRead
+		}
+		n := copy(p, f.buf[off:])
+		if n < len(p) {
+			return n, errTruncatedRead
+		}
+		return n, nil
 	}
 
-	p.layerMask = layerMask
-	return nil
+	n, err := f.r.ReadAt(p, off)
+	if n == len(p) {
+		return n, nil
+	}
+	if err == nil || err == io.EOF {
+		err = errTruncatedRead
+	}
+	return n, err
 }
 
-func (p *PSD) parseImage() error {
-	if p.image != nil {
+// buffered returns the buffered bytes from the current position, if any
+func (f *File) buffered() []byte {
+	if f.pos < f.bufStart || f.pos >= f.bufStart+int64(len(f.buf)) {
 		return nil
 	}
+	return f.buf[f.pos-f.bufStart:]
+}
 
-	if p.header == nil {
-		if err := p.parseHeader(); err != nil {
-			return err
-		}
+// fill refills the buffer starting at the current position
+func (f *File) fill() error {
+	if f.fixed {
+		return nil
 	}
+	size := int64(fileBufferSize)
+	if rem := f.Remaining(); rem < size {
+		size = rem
+	}
+	if cap(f.buf) < int(size) {
+		f.buf = make([]byte, size)
+	}
+	f.buf = f.buf[:size]
+	f.bufStart = f.pos
 
-	if p.resources == nil {
-		if err := p.parseResources(); err != nil {
-			return err
-		}
+	n, err := f.r.ReadAt(f.buf, f.pos)
+	f.buf = f.buf[:n]
+	if n == int(size) || err == io.EOF {
+		return nil
 	}
+	return err
+}
 
-	if p.layerMask == nil {
-		if err := p.parseLayerMask(); err != nil {
-			return err
+// next returns a view of the next n bytes and advances past them. The view
+// is only valid until the next read.
+func (f *File) next(n int) ([]byte, error) {
+	b := f.buffered()
+	if len(b) < n && n <= fileBufferSize {
+		if err := f.fill(); err != nil {
+			return nil, err
 		}
+		b = f.buffered()
 	}
-
-	image := &Image{file: p.file, header: p.header}
-	if err := image.Parse(); err != nil {
-		return err
+	if len(b) < n {
+		f.pos += int64(len(b))
+		return nil, errTruncatedRead
 	}
-
-	p.image = image
-	return nil
+	f.pos += int64(n)
+	return b[:n], nil
 }
 
-// File represents a PSD file with convenience methods for reading binary data
-type File struct {
-	file   *os.File
-	reader io.Reader
+// Read reads len(p) bytes from the current position like io.ReadFull. It
+// returns io.EOF if no bytes remain and io.ErrUnexpectedEOF if fewer than
+// len(p) do.
+func (f *File) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.pos >= f.size {
+		return 0, io.EOF
+	}
+	n, err = f.readFull(p)
+	if errors.Is(err, ErrTruncated) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
 }
 
-// Read reads bytes from the file
-func (f *File) Read(p []byte) (n int, error error) {
-	return io.ReadFull(f.reader, p)
+// readFull reads exactly len(p) bytes from the current position, failing
+// with errTruncatedRead at the end of the file
+func (f *File) readFull(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.pos >= f.size {
+		return 0, errTruncatedRead
+	}
+
+	// Serve what the buffer holds, then read large remainders directly
+	// and small ones through a refill
+	n = copy(p, f.buffered())
+	f.pos += int64(n)
+	if n == len(p) {
+		return n, nil
+	}
+	if len(p)-n < fileBufferSize && !f.fixed {
+		if err := f.fill(); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], f.buffered())
+		f.pos += int64(m)
+		n += m
+		if n == len(p) {
+			return n, nil
+		}
+		return n, errTruncatedRead
+	}
+	if f.fixed {
+		return n, errTruncatedRead
+	}
+
+	m, err := f.r.ReadAt(p[n:], f.pos)
+	f.pos += int64(m)
+	n += m
+	if n == len(p) {
+		return n, nil
+	}
+	if err == nil || err == io.EOF {
+		err = errTruncatedRead
+	}
+	return n, err
 }
 
 // Seek seeks to a position in the file
 func (f *File) Seek(offset int64, whence int) (int64, error) {
-	return f.file.Seek(offset, whence)
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.pos + offset
+	case io.SeekEnd:
+		abs = f.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position: %d", abs)
+	}
+	f.pos = abs
+	return abs, nil
 }
 
 // Tell returns the current position in the file
 func (f *File) Tell() (int64, error) {
-	return f.file.Seek(0, io.SeekCurrent)
+	return f.pos, nil
+}
+
+// Size returns the total size of the document in bytes
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// Close closes the underlying source if the File owns it
+func (f *File) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
 }
 
 // ReadString reads a string of specified length
 func (f *File) ReadString(length int) (string, error) {
-	buf := make([]byte, length)
-	if _, err := f.Read(buf); err != nil {
+	if length <= fileBufferSize {
+		b, err := f.next(length)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	buf, err := f.ReadBytes(uint64(length))
+	if err != nil {
 		return "", err
 	}
 	return string(buf), nil
 }
 
+// ReadBytes reads n bytes. It fails without allocating when fewer than n
+// bytes remain, so lengths read from the file cannot force large buffers.
+func (f *File) ReadBytes(n uint64) ([]byte, error) {
+	if n > uint64(f.Remaining()) {
+		return nil, errTruncatedRead
+	}
+	buf := make([]byte, n)
+	if _, err := f.readFull(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Remaining returns the number of bytes after the current position
+func (f *File) Remaining() int64 {
+	if f.pos >= f.size {
+		return 0
+	}
+	return f.size - f.pos
+}
+
 // ReadByte reads a single byte
 func (f *File) ReadByte() (byte, error) {
-	buf := make([]byte, 1)
-	if _, err := f.Read(buf); err != nil {
+	b, err := f.next(1)
+	if err != nil {
 		return 0, err
 	}
-	return buf[0], nil
+	return b[0], nil
 }
 
 // ReadUint16 reads a 16-bit unsigned integer (big endian)
 func (f *File) ReadUint16() (uint16, error) {
-	buf := make([]byte, 2)
-	if _, err := f.Read(buf); err != nil {
+	b, err := f.next(2)
+	if err != nil {
 		return 0, err
 	}
-	return binary.BigEndian.Uint16(buf), nil
+	return binary.BigEndian.Uint16(b), nil
 }
 
 // ReadInt16 reads a 16-bit signed integer (big endian)
 func (f *File) ReadInt16() (int16, error) {
-	buf := make([]byte, 2)
-	if _, err := f.Read(buf); err != nil {
-		return 0, err
-	}
-	return int16(binary.BigEndian.Uint16(buf)), nil
+	v, err := f.ReadUint16()
+	return int16(v), err
 }
 
 // ReadUint32 reads a 32-bit unsigned integer (big endian)
 func (f *File) ReadUint32() (uint32, error) {
-	buf := make([]byte, 4)
-	if _, err := f.Read(buf); err != nil {
+	b, err := f.next(4)
+	if err != nil {
 		return 0, err
 	}
-	return binary.BigEndian.Uint32(buf), nil
+	return binary.BigEndian.Uint32(b), nil
 }
 
 // ReadInt32 reads a 32-bit signed integer (big endian)
 func (f *File) ReadInt32() (int32, error) {
-	buf := make([]byte, 4)
-	if _, err := f.Read(buf); err != nil {
-		return 0, err
-	}
-	return int32(binary.BigEndian.Uint32(buf)), nil
+	v, err := f.ReadUint32()
+	return int32(v), err
 }
 
 // ReadUint64 reads a 64-bit unsigned integer (big endian)
 func (f *File) ReadUint64() (uint64, error) {
-	buf := make([]byte, 8)
-	if _, err := f.Read(buf); err != nil {
+	b, err := f.next(8)
+	if err != nil {
 		return 0, err
 	}
-	return binary.BigEndian.Uint64(buf), nil
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// ReadLength reads a length field that is 4 bytes wide in PSD documents and
+// 8 bytes wide in PSB (large document format) documents
+func (f *File) ReadLength(big bool) (uint64, error) {
+	if big {
+		return f.ReadUint64()
+	}
+	length, err := f.ReadUint32()
+	return uint64(length), err
 }
 
 // Skip skips n bytes
@@ -1,7 +1,12 @@
 package psd
 
 import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,3 +35,121 @@ func TestOpen(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, parsed)
 }
+
+func TestNewFromBytes(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.psd")
+	require.NoError(t, err)
+
+	psd, err := NewFromBytes(data)
+	require.NoError(t, err)
+	defer psd.Close()
+
+	require.NoError(t, psd.Parse())
+	assert.Equal(t, uint32(900), psd.Header().Width())
+	assert.Equal(t, 15, len(psd.Layers()))
+}
+
+func TestNewFromReaderAt(t *testing.T) {
+	f, err := os.Open("testdata/pixel.psd")
+	require.NoError(t, err)
+	defer f.Close()
+
+	info, err := f.Stat()
+	require.NoError(t, err)
+
+	psd, err := NewFromReaderAt(f, info.Size())
+	require.NoError(t, err)
+	require.NoError(t, psd.Parse())
+
+	// Closing the PSD must not close a caller-owned reader
+	require.NoError(t, psd.Close())
+	_, err = f.Stat()
+	assert.NoError(t, err)
+}
+
+func TestOpenFS(t *testing.T) {
+	data, err := os.ReadFile("testdata/pixel.psd")
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{"docs/pixel.psd": &fstest.MapFile{Data: data}}
+
+	var width uint32
+	err = OpenFS(fsys, "docs/pixel.psd", func(psd *PSD) error {
+		width = psd.Header().Width()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), width)
+
+	err = OpenFS(os.DirFS("testdata"), "example.psd", func(psd *PSD) error {
+		width = psd.Header().Width()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(900), width)
+
+	_, err = NewFromFS(fsys, "missing.psd")
+	assert.Error(t, err)
+}
+
+func TestNewFromBytesTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.psd")
+	require.NoError(t, err)
+
+	psd, err := NewFromBytes(data[:20])
+	require.NoError(t, err)
+	assert.Error(t, psd.Parse())
+}
+
+func TestFileBufferedReads(t *testing.T) {
+	data := make([]byte, 3*fileBufferSize+5)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for name, f := range map[string]*File{
+		"reader": newFile(bytes.NewReader(data), int64(len(data)), nil),
+		"bytes":  newFileFromBytes(data),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Integers straddling the buffer boundary
+			_, err := f.Seek(fileBufferSize-2, io.SeekStart)
+			require.NoError(t, err)
+			v, err := f.ReadUint32()
+			require.NoError(t, err)
+			assert.Equal(t, binary.BigEndian.Uint32(data[fileBufferSize-2:]), v)
+
+			// Seeking back before the buffer
+			_, err = f.Seek(1, io.SeekStart)
+			require.NoError(t, err)
+			b, err := f.ReadByte()
+			require.NoError(t, err)
+			assert.Equal(t, byte(1), b)
+
+			// Reads larger than the buffer
+			buf, err := f.ReadBytes(2*fileBufferSize + 1)
+			require.NoError(t, err)
+			assert.Equal(t, data[2:2*fileBufferSize+3], buf)
+			pos, _ := f.Tell()
+			assert.Equal(t, int64(2*fileBufferSize+3), pos)
+
+			// Short reads at the end
+			_, err = f.Seek(-3, io.SeekEnd)
+			require.NoError(t, err)
+			_, err = f.ReadUint32()
+			assert.ErrorIs(t, err, ErrTruncated)
+			_, err = f.ReadBytes(1)
+			assert.ErrorIs(t, err, ErrTruncated)
+
+			// Read follows io.Reader at the end of the file
+			_, err = f.Seek(-3, io.SeekEnd)
+			require.NoError(t, err)
+			n, err := f.Read(make([]byte, 4))
+			assert.Equal(t, 3, n)
+			assert.Equal(t, io.ErrUnexpectedEOF, err)
+			n, err = f.Read(make([]byte, 4))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
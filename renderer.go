@@ -1,10 +1,16 @@
 package psd
 
 import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
 	"os"
 )
 
@@ -12,6 +18,7 @@ import (
 type RendererOptions struct {
 	ExcludeTextLayers bool     // Exclude text layers from rendering
 	ExcludeTypes      []string // Exclude specific node types
+	ReleaseChannels   bool     // Release each layer's decoded channels once composited
 }
 
 // Renderer handles rendering nodes to images
@@ -19,6 +26,10 @@ type Renderer struct {
 	node    *Node
 	canvas  *image.RGBA
 	options RendererOptions
+
+	// layerImages caches converted layer images when set, for renderers
+	// that share layers such as those of RenderComps
+	layerImages map[*Layer]*image.RGBA
 }
 
 // NewRenderer creates a new renderer for the given node
@@ -43,6 +54,13 @@ func NewRendererWithOptions(node *Node, options RendererOptions) *Renderer {
 
 // Render renders the node and all its children to an image
 func (r *Renderer) Render() (*image.RGBA, error) {
+	return r.RenderContext(context.Background())
+}
+
+// RenderContext renders like Render, stopping when ctx is done. Cancellation
+// is checked between layers, channels and scanlines, and ctx.Err() is
+// returned. The canvas is cleared on the next render.
+func (r *Renderer) RenderContext(ctx context.Context) (*image.RGBA, error) {
 	// Clear canvas with transparent background
 	for y := 0; y < r.canvas.Bounds().Dy(); y++ {
 		for x := 0; x < r.canvas.Bounds().Dx(); x++ {
@@ -51,7 +69,10 @@ func (r *Renderer) Render() (*image.RGBA, error) {
 	}
 
 	// Render the node
-	if err := r.renderNode(r.node, 0, 0); err != nil {
+	if err := r.renderNode(ctx, r.node, 0, 0); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
 
@@ -59,7 +80,10 @@ func (r *Renderer) Render() (*image.RGBA, error) {
 }
 
 // renderNode recursively renders a node and its children
-func (r *Renderer) renderNode(node *Node, offsetX, offsetY int32) error {
+func (r *Renderer) renderNode(ctx context.Context, node *Node, offsetX, offsetY int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if !node.Visible {
 		return nil
 	}
@@ -72,13 +96,17 @@ func (r *Renderer) renderNode(node *Node, offsetX, offsetY int32) error {
 	if node.Type == NodeTypeLayer {
 		// Render layer
 		if node.Layer != nil {
-			return r.renderLayer(node.Layer, offsetX, offsetY)
+			err := r.renderLayer(ctx, node, offsetX, offsetY)
+			if r.options.ReleaseChannels {
+				node.Layer.ReleaseChannels()
+			}
+			return err
 		}
 	} else if node.Type == NodeTypeGroup || node.Type == NodeTypeRoot {
 		// Render children in reverse order (bottom to top)
 		for i := len(node.Children) - 1; i >= 0; i-- {
 			child := node.Children[i]
-			if err := r.renderNode(child, offsetX, offsetY); err != nil {
+			if err := r.renderNode(ctx, child, offsetX, offsetY); err != nil {
 				return err
 			}
 		}
@@ -104,20 +132,32 @@ func (r *Renderer) shouldExcludeNode(node *Node) bool {
 	return false
 }
 
-// renderLayer renders a single layer to the canvas
+// renderLayer renders a single layer to the canvas at the node's position,
+// opacity and blend mode, which FilterByLayerComp may have changed
 // This matches Ruby's Blender.compose! method (blender.rb:18-42)
-func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
+func (r *Renderer) renderLayer(ctx context.Context, node *Node, offsetX, offsetY int32) error {
+	layer := node.Layer
+
+	// Decode channels of lazily parsed layers. The renderer works on this
+	// snapshot, so other goroutines may release the layer's channels.
+	channels, err := layer.loadChannels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load layer channels: %w", err)
+	}
+
 	// Skip if layer has no image data
-	if len(layer.channels) == 0 {
+	if len(channels) == 0 {
 		return nil
 	}
 
 	// Get layer image
-	layerImg, err := layer.ToImage()
-	if err != nil {
-		return fmt.Errorf("failed to get layer image: %w", err)
+	layerImg, cached := r.layerImages[layer]
+	if !cached {
+		layerImg = layer.toImage(channels)
+		if r.layerImages != nil {
+			r.layerImages[layer] = layerImg
+		}
 	}
-
 	if layerImg == nil {
 		return nil
 	}
@@ -126,8 +166,8 @@ func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
 	// The renderer's canvas starts at node's top-left corner (0,0)
 	// Layer positions are relative to the PSD document
 	// We need to adjust layer position relative to the node being rendered
-	canvasX := int(layer.Left - r.node.Left + offsetX)
-	canvasY := int(layer.Top - r.node.Top + offsetY)
+	canvasX := int(node.Left - r.node.Left + offsetX)
+	canvasY := int(node.Top - r.node.Top + offsetY)
 
 	// Get layer bounds
 	layerBounds := layerImg.Bounds()
@@ -135,14 +175,14 @@ func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
 	// Calculate opacity using Ruby's formula:
 	// calculated_opacity = opacity * fill_opacity / 255
 	// This matches Ruby's Blender.calculated_opacity (blender.rb:50)
-	calculatedOpacity := uint8((uint32(layer.Opacity) * uint32(layer.FillOpacity())) / 255)
+	calculatedOpacity := uint8((uint32(node.Opacity) * uint32(node.FillOpacity())) / 255)
 
 	// Get mask data if present
 	// This matches Ruby's Canvas.apply_masks (canvas.rb:52-55)
 	var maskData []byte
 	isDebugLayer := layer.Name == "攻城CG图"
 	if layer.Mask != nil && !layer.Mask.IsEmpty() {
-		if ch, exists := layer.channels[-2]; exists {
+		if ch, exists := channels[-2]; exists {
 			maskData = ch.Data
 			if isDebugLayer {
 				fmt.Printf("[DEBUG] Layer '%s' has mask: %dx%d, data length: %d\n",
@@ -154,6 +194,9 @@ func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
 	// Composite layer onto canvas pixel by pixel
 	// This matches Ruby's Blender.compose! loop (blender.rb:30-41)
 	for y := layerBounds.Min.Y; y < layerBounds.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for x := layerBounds.Min.X; x < layerBounds.Max.X; x++ {
 			// Calculate destination position
 			dstX := canvasX + x
@@ -210,8 +253,7 @@ func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
 					}
 				} else {
 					maskIdx := maskY*maskWidth + maskX
-					if maskIdx < len(maskData) {
-						maskValue := maskData[maskIdx]
+					if maskValue, ok := sample8(maskData, maskIdx, maskWidth, layer.header.Depth); ok {
 						oldA := a >> 8
 						// Apply mask value to alpha
 						// This matches Ruby's: color[3] = color[3] * @mask_data[@mask_width * mask_y + mask_x] / 255
@@ -242,7 +284,7 @@ func (r *Renderer) renderLayer(layer *Layer, offsetX, offsetY int32) error {
 
 			// Get blend function based on layer's blend mode
 			// This matches Ruby's: Compose.send(fg.node.blending_mode, ...)
-			blendFunc := GetBlendFunc(layer.BlendModeKey)
+			blendFunc := GetBlendFunc(node.BlendMode)
 			blended := blendFunc(srcColor, dstColor, calculatedOpacity)
 
 			if debugPixel {
@@ -266,7 +308,23 @@ func (n *Node) ToPNG() (*image.RGBA, error) {
 
 // SaveAsPNG renders the node and saves it as a PNG file
 func (n *Node) SaveAsPNG(filename string) error {
-	img, err := n.ToPNG()
+	return n.SaveAsPNGWithOptions(filename, PNGOptions{})
+}
+
+// PNGOptions controls how PNG files are written
+type PNGOptions struct {
+	RendererOptions
+
+	// ICCProfile is embedded in an iCCP chunk if it is an RGB profile.
+	// Embed the document's profile when its colours are not converted to
+	// sRGB with ColorOptions.Profile, so viewers can colour manage the PNG.
+	ICCProfile *ICCProfile
+}
+
+// SaveAsPNGWithOptions renders the node with options and saves it as a PNG
+// file
+func (n *Node) SaveAsPNGWithOptions(filename string, opts PNGOptions) error {
+	img, err := n.ToPNGWithOptions(opts.RendererOptions)
 	if err != nil {
 		return fmt.Errorf("failed to render node: %w", err)
 	}
@@ -277,9 +335,79 @@ func (n *Node) SaveAsPNG(filename string) error {
 	}
 	defer file.Close()
 
-	if err := png.Encode(file, img); err != nil {
+	if err := EncodePNG(file, img, opts.ICCProfile); err != nil {
 		return fmt.Errorf("failed to encode PNG: %w", err)
 	}
 
 	return nil
 }
+
+// pngHeaderSize is the size of the PNG signature and the IHDR chunk, which
+// the iCCP chunk follows
+const pngHeaderSize = 8 + 12 + 13
+
+// pngColorTypePos is the offset of the colour type in the IHDR chunk
+const pngColorTypePos = 8 + 8 + 9
+
+// EncodePNG writes img to w as a PNG. If profile is not nil it is embedded
+// in an iCCP chunk when its colour space matches the PNG: RGB for truecolour
+// and paletted images, gray for grayscale ones. Other profiles are skipped.
+func EncodePNG(w io.Writer, img image.Image, profile *ICCProfile) error {
+	if profile == nil {
+		return png.Encode(w, img)
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+
+	data := encoded.Bytes()
+	space := ICCColorSpaceRGB
+	if colorType := data[pngColorTypePos]; colorType == 0 || colorType == 4 {
+		space = ICCColorSpaceGray
+	}
+	if profile.Header.ColorSpace != space {
+		_, err := w.Write(data)
+		return err
+	}
+
+	// Profile name, null separator, compression method 0 (zlib) and the
+	// compressed profile
+	var chunk bytes.Buffer
+	chunk.WriteString("ICC Profile\x00\x00")
+	zw := zlib.NewWriter(&chunk)
+	zw.Write(profile.Data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data[:pngHeaderSize]); err != nil {
+		return err
+	}
+	if err := writePNGChunk(w, "iCCP", chunk.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data[pngHeaderSize:])
+	return err
+}
+
+// writePNGChunk writes a chunk with its length and CRC
+func writePNGChunk(w io.Writer, kind string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], kind)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	for _, b := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
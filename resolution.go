@@ -0,0 +1,192 @@
+package psd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// resourceResolutionInfo is the ID of the ResolutionInfo resource
+const resourceResolutionInfo = 1005
+
+// Unit is a physical length unit as stored in ResolutionInfo
+type Unit int16
+
+const (
+	UnitInches      Unit = 1
+	UnitCentimeters Unit = 2
+	UnitPoints      Unit = 3
+	UnitPicas       Unit = 4
+	UnitColumns     Unit = 5 // Depends on application preferences; cannot be converted
+)
+
+// String returns the name of the unit
+func (u Unit) String() string {
+	switch u {
+	case UnitInches:
+		return "in"
+	case UnitCentimeters:
+		return "cm"
+	case UnitPoints:
+		return "pt"
+	case UnitPicas:
+		return "pica"
+	case UnitColumns:
+		return "columns"
+	default:
+		return fmt.Sprintf("Unit(%d)", int16(u))
+	}
+}
+
+// perInch returns the number of units in one inch
+func (u Unit) perInch() (float64, error) {
+	switch u {
+	case UnitInches:
+		return 1, nil
+	case UnitCentimeters:
+		return 2.54, nil
+	case UnitPoints:
+		return 72, nil
+	case UnitPicas:
+		return 6, nil
+	default:
+		return 0, fmt.Errorf("unsupported unit: %v", u)
+	}
+}
+
+// ResolutionUnit is the unit a resolution is displayed in
+type ResolutionUnit int16
+
+const (
+	ResolutionPixelsPerInch       ResolutionUnit = 1
+	ResolutionPixelsPerCentimeter ResolutionUnit = 2
+)
+
+// ResolutionInfo represents the resolution info resource (ID 1005).
+// Resolutions are always stored in pixels per inch; the units only select
+// how Photoshop displays them.
+type ResolutionInfo struct {
+	HorizontalResolution     float64 // Pixels per inch
+	HorizontalResolutionUnit ResolutionUnit
+	WidthUnit                Unit
+	VerticalResolution       float64 // Pixels per inch
+	VerticalResolutionUnit   ResolutionUnit
+	HeightUnit               Unit
+}
+
+// defaultResolution is used for documents without ResolutionInfo
+var defaultResolution = ResolutionInfo{
+	HorizontalResolution:     72,
+	HorizontalResolutionUnit: ResolutionPixelsPerInch,
+	WidthUnit:                UnitInches,
+	VerticalResolution:       72,
+	VerticalResolutionUnit:   ResolutionPixelsPerInch,
+	HeightUnit:               UnitInches,
+}
+
+// ParseResolutionInfo parses the resolution info resource (ID 1005). Files
+// without one are reported at 72 pixels per inch.
+func (r *ResourceSection) ParseResolutionInfo() (*ResolutionInfo, error) {
+	data := r.resourceData(resourceResolutionInfo)
+	if len(data) == 0 {
+		info := defaultResolution
+		return &info, nil
+	}
+	return parseResolutionInfo(data)
+}
+
+func parseResolutionInfo(data []byte) (*ResolutionInfo, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("resolution info: %w", errTruncatedRead)
+	}
+	return &ResolutionInfo{
+		HorizontalResolution:     fixedToFloat(binary.BigEndian.Uint32(data[0:])),
+		HorizontalResolutionUnit: ResolutionUnit(binary.BigEndian.Uint16(data[4:])),
+		WidthUnit:                Unit(binary.BigEndian.Uint16(data[6:])),
+		VerticalResolution:       fixedToFloat(binary.BigEndian.Uint32(data[8:])),
+		VerticalResolutionUnit:   ResolutionUnit(binary.BigEndian.Uint16(data[12:])),
+		HeightUnit:               Unit(binary.BigEndian.Uint16(data[14:])),
+	}, nil
+}
+
+// fixedToFloat converts a 16.16 fixed point number
+func fixedToFloat(v uint32) float64 {
+	return float64(v) / 65536
+}
+
+// ToUnits converts a horizontal and a vertical distance in pixels to unit
+func (r *ResolutionInfo) ToUnits(x, y float64, unit Unit) (float64, float64, error) {
+	perInch, err := unit.perInch()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := r.validate(); err != nil {
+		return 0, 0, err
+	}
+	return x / r.HorizontalResolution * perInch, y / r.VerticalResolution * perInch, nil
+}
+
+// ToPixels converts a horizontal and a vertical distance in unit to pixels
+func (r *ResolutionInfo) ToPixels(x, y float64, unit Unit) (float64, float64, error) {
+	perInch, err := unit.perInch()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := r.validate(); err != nil {
+		return 0, 0, err
+	}
+	return x / perInch * r.HorizontalResolution, y / perInch * r.VerticalResolution, nil
+}
+
+// validate returns an error if either resolution is not positive
+func (r *ResolutionInfo) validate() error {
+	if r.HorizontalResolution <= 0 || r.VerticalResolution <= 0 {
+		return fmt.Errorf("invalid resolution: %gx%g", r.HorizontalResolution, r.VerticalResolution)
+	}
+	return nil
+}
+
+// Pixels returns the position of the guide in pixels. Guide positions are
+// stored in 1/32 of a pixel.
+func (g Guide) Pixels() float64 {
+	return float64(g.Position) / 32
+}
+
+// Resolution returns the resolution info of the document
+func (p *PSD) Resolution() (*ResolutionInfo, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseResolutionInfo()
+}
+
+// ToUnits converts a horizontal and a vertical distance in pixels, such as
+// a point, a slice's bounds or Guide.Pixels, to unit using the document's
+// resolution
+func (p *PSD) ToUnits(x, y float64, unit Unit) (float64, float64, error) {
+	resolution, err := p.Resolution()
+	if err != nil {
+		return 0, 0, err
+	}
+	return resolution.ToUnits(x, y, unit)
+}
+
+// ToPixels converts a horizontal and a vertical distance in unit to pixels
+// using the document's resolution
+func (p *PSD) ToPixels(x, y float64, unit Unit) (float64, float64, error) {
+	resolution, err := p.Resolution()
+	if err != nil {
+		return 0, 0, err
+	}
+	return resolution.ToPixels(x, y, unit)
+}
+
+// PhysicalSize returns the print size of the document in unit
+func (p *PSD) PhysicalSize(unit Unit) (width, height float64, err error) {
+	header, err := p.parseHeader()
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.ToUnits(float64(header.Width()), float64(header.Height()), unit)
+}
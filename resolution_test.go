@@ -0,0 +1,93 @@
+package psd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolutionData(ppi float64, unit ResolutionUnit, displayUnit Unit) []byte {
+	buf := new(bytes.Buffer)
+	for i := 0; i < 2; i++ {
+		writeBE(buf, uint32(ppi*65536))
+		writeBE(buf, unit)
+		writeBE(buf, displayUnit)
+	}
+	return buf.Bytes()
+}
+
+func TestResolutionInfo(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	resolution, err := psd.Resolution()
+	require.NoError(t, err)
+	assert.InDelta(t, 72.009, resolution.HorizontalResolution, 0.001)
+	assert.InDelta(t, 72.009, resolution.VerticalResolution, 0.001)
+	assert.Equal(t, ResolutionPixelsPerInch, resolution.HorizontalResolutionUnit)
+	assert.Equal(t, UnitInches, resolution.WidthUnit)
+	assert.Equal(t, UnitInches, resolution.HeightUnit)
+
+	// Guides are stored in 1/32 of a pixel
+	guides, err := psd.Guides()
+	require.NoError(t, err)
+	assert.Equal(t, 300.0, guides.Guides[0].Pixels())
+}
+
+func TestPhysicalUnits(t *testing.T) {
+	doc := &testDoc{
+		version: 1, channels: 3, width: 600, height: 300, depth: 8, mode: 3,
+		resources: []testResource{{id: 1005, data: resolutionData(300, ResolutionPixelsPerCentimeter, UnitCentimeters)}},
+	}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+
+	width, height, err := psd.PhysicalSize(UnitInches)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, width)
+	assert.Equal(t, 1.0, height)
+
+	for unit, want := range map[Unit]float64{
+		UnitInches:      1,
+		UnitCentimeters: 2.54,
+		UnitPoints:      72,
+		UnitPicas:       6,
+	} {
+		x, y, err := psd.ToUnits(300, 150, unit)
+		require.NoError(t, err)
+		assert.InDelta(t, want, x, 1e-9, unit.String())
+		assert.InDelta(t, want/2, y, 1e-9, unit.String())
+
+		x, y, err = psd.ToPixels(x, y, unit)
+		require.NoError(t, err)
+		assert.InDelta(t, 300, x, 1e-9, unit.String())
+		assert.InDelta(t, 150, y, 1e-9, unit.String())
+	}
+
+	_, _, err = psd.ToUnits(1, 1, UnitColumns)
+	assert.Error(t, err)
+}
+
+func TestResolutionInfoDefaults(t *testing.T) {
+	doc := &testDoc{version: 1, channels: 3, width: 72, height: 144, depth: 8, mode: 3}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+
+	// Documents without ResolutionInfo are 72 pixels per inch
+	width, height, err := psd.PhysicalSize(UnitInches)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, width)
+	assert.Equal(t, 2.0, height)
+
+	_, err = parseResolutionInfo([]byte{0, 72, 0, 0})
+	assert.ErrorIs(t, err, errTruncatedRead)
+
+	zero := &ResolutionInfo{}
+	_, _, err = zero.ToUnits(1, 1, UnitInches)
+	assert.ErrorContains(t, err, "invalid resolution")
+	_, _, err = zero.ToPixels(1, 1, UnitInches)
+	assert.ErrorContains(t, err, "invalid resolution")
+}
@@ -2,8 +2,17 @@ package psd
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"strconv"
+)
+
+// Resource IDs of the slices and guides
+const (
+	resourceGridGuides = 1032
+	resourceSlices     = 1050
 )
 
 // Resource represents a single image resource
@@ -17,6 +26,7 @@ type Resource struct {
 // ResourceSection represents the image resources section
 type ResourceSection struct {
 	file      *File
+	state     *parseState
 	Resources map[uint16]*Resource
 }
 
@@ -68,6 +78,11 @@ type GuidesResource struct {
 
 // Parse parses the resources section
 func (r *ResourceSection) Parse() error {
+	return r.parse(context.Background())
+}
+
+// parse parses the resources, stopping between resources when ctx is done
+func (r *ResourceSection) parse(ctx context.Context) error {
 	// Read resources length
 	length, err := r.file.ReadUint32()
 	if err != nil {
@@ -97,10 +112,29 @@ func (r *ResourceSection) Parse() error {
 		if currentPos >= endPos {
 			break
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		resource, err := r.parseResource()
+		resource, end, err := r.parseResource()
 		if err != nil {
-			return fmt.Errorf("failed to parse resource: %w", err)
+			var key string
+			if resource.ID != 0 {
+				key = strconv.Itoa(int(resource.ID))
+			}
+			err = newParseError(SectionResources, -1, key, currentPos, fmt.Errorf("failed to parse resource: %w", err))
+			if !r.state.recover(err) {
+				return err
+			}
+			if end == 0 || end >= endPos {
+				// The next resource cannot be located; keep the resources
+				// read so far
+				break
+			}
+			if _, err := r.file.Seek(end, io.SeekStart); err != nil {
+				return err
+			}
+			continue
 		}
 
 		r.Resources[resource.ID] = resource
@@ -109,33 +143,36 @@ func (r *ResourceSection) Parse() error {
 	return nil
 }
 
-func (r *ResourceSection) parseResource() (*Resource, error) {
+// parseResource parses one resource block and returns it with the padded
+// position of its end. On error the fields read so far are returned
+// alongside it, and the end if its length was read, or 0.
+func (r *ResourceSection) parseResource() (*Resource, int64, error) {
 	resource := &Resource{}
 
 	// Read type signature (4 bytes) - should be "8BIM"
 	resourceType, err := r.file.ReadString(4)
 	if err != nil {
-		return nil, err
+		return resource, 0, err
 	}
 	resource.Type = resourceType
 
 	// Read resource ID (2 bytes)
 	id, err := r.file.ReadUint16()
 	if err != nil {
-		return nil, err
+		return resource, 0, err
 	}
 	resource.ID = id
 
 	// Read Pascal string for name
 	nameLen, err := r.file.ReadByte()
 	if err != nil {
-		return nil, err
+		return resource, 0, err
 	}
 
 	if nameLen > 0 {
 		name, err := r.file.ReadString(int(nameLen))
 		if err != nil {
-			return nil, err
+			return resource, 0, err
 		}
 		resource.Name = name
 	}
@@ -143,38 +180,46 @@ func (r *ResourceSection) parseResource() (*Resource, error) {
 	// Pascal string is padded to even size
 	if (nameLen+1)%2 != 0 {
 		if err := r.file.Skip(1); err != nil {
-			return nil, err
+			return resource, 0, err
 		}
 	}
 
 	// Read resource data size
 	dataSize, err := r.file.ReadUint32()
 	if err != nil {
-		return nil, err
+		return resource, 0, err
 	}
+	dataPos, err := r.file.Tell()
+	if err != nil {
+		return resource, 0, err
+	}
+	// Data is padded to even size
+	end := dataPos + int64(dataSize) + int64(dataSize%2)
 
 	// Read resource data
 	if dataSize > 0 {
-		data := make([]byte, dataSize)
-		if _, err := r.file.Read(data); err != nil {
-			return nil, err
+		if err := r.state.limits().checkResource("resource", uint64(dataSize)); err != nil {
+			return resource, end, err
+		}
+		data, err := r.file.ReadBytes(uint64(dataSize))
+		if err != nil {
+			return resource, end, err
 		}
 		resource.Data = data
 
-		// Data is padded to even size
 		if dataSize%2 != 0 {
 			if err := r.file.Skip(1); err != nil {
-				return nil, err
+				return resource, end, err
 			}
 		}
 	}
 
-	return resource, nil
+	return resource, end, nil
 }
 
 // ParseSlices parses the slices resource (ID 1050)
 func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
-	resource, exists := r.Resources[1050]
+	resource, exists := r.Resources[resourceSlices]
 	if !exists || len(resource.Data) == 0 {
 		// Return default slice for files without slices
 		return &SlicesResource{
@@ -182,8 +227,11 @@ func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
 			Slices:  []Slice{{ID: 0}},
 		}, nil
 	}
+	return parseSlices(resource.Data, r.state.limits())
+}
 
-	reader := bytes.NewReader(resource.Data)
+func parseSlices(data []byte, limits Limits) (*SlicesResource, error) {
+	reader := bytes.NewReader(data)
 	result := &SlicesResource{}
 
 	// Read version
@@ -203,6 +251,9 @@ func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
 			return nil, err
 		}
 		if nameLen > 0 {
+			if uint64(nameLen)*2 > uint64(reader.Len()) {
+				return nil, errTruncatedRead
+			}
 			nameBytes := make([]byte, nameLen*2) // Unicode is 2 bytes per char
 			if _, err := reader.Read(nameBytes); err != nil {
 				return nil, err
@@ -216,6 +267,10 @@ func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
 			return nil, err
 		}
 
+		// Each slice takes at least 36 bytes
+		if sliceCount < 0 || int64(sliceCount)*36 > int64(reader.Len()) {
+			return nil, fmt.Errorf("invalid slice count: %d", sliceCount)
+		}
 		result.Slices = make([]Slice, sliceCount)
 		for i := int32(0); i < sliceCount; i++ {
 			slice := &result.Slices[i]
@@ -231,7 +286,7 @@ func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
 			// Read name
 			var nameLen uint32
 			binary.Read(reader, binary.BigEndian, &nameLen)
-			if nameLen > 0 {
+			if nameLen > 0 && uint64(nameLen)*2 <= uint64(reader.Len()) {
 				nameBytes := make([]byte, nameLen*2)
 				reader.Read(nameBytes)
 				slice.Name = decodeUnicodeString(nameBytes)
@@ -273,7 +328,7 @@ func (r *ResourceSection) ParseSlices() (*SlicesResource, error) {
 		}
 
 		// Parse descriptor
-		descParser := NewDescriptorParser(remainingBytes)
+		descParser := NewDescriptorParserWithLimits(remainingBytes, limits)
 		desc, err := descParser.Parse()
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse slice descriptor: %w", err)
@@ -369,12 +424,15 @@ func normalizeSliceV7(data map[string]interface{}) Slice {
 
 // ParseGuides parses the guides resource (ID 1032)
 func (r *ResourceSection) ParseGuides() (*GuidesResource, error) {
-	resource, exists := r.Resources[1032]
+	resource, exists := r.Resources[resourceGridGuides]
 	if !exists || len(resource.Data) == 0 {
 		return &GuidesResource{Guides: []Guide{}}, nil
 	}
+	return parseGuides(resource.Data)
+}
 
-	reader := bytes.NewReader(resource.Data)
+func parseGuides(data []byte) (*GuidesResource, error) {
+	reader := bytes.NewReader(data)
 	result := &GuidesResource{}
 
 	// Skip version (4 bytes) and grid info (8 bytes)
@@ -386,6 +444,10 @@ func (r *ResourceSection) ParseGuides() (*GuidesResource, error) {
 		return nil, err
 	}
 
+	// Each guide takes 5 bytes
+	if uint64(guideCount)*5 > uint64(reader.Len()) {
+		return nil, fmt.Errorf("invalid guide count: %d", guideCount)
+	}
 	result.Guides = make([]Guide, guideCount)
 	for i := uint32(0); i < guideCount; i++ {
 		var position int32
@@ -403,20 +465,6 @@ func (r *ResourceSection) ParseGuides() (*GuidesResource, error) {
 	return result, nil
 }
 
-// LayerComps returns layer comps from resources
-func (r *ResourceSection) LayerComps() []LayerComp {
-	// Resource ID 1065 contains layer comps
-	// This is a simplified implementation
-	// Full implementation would need to parse the descriptor data
-	return []LayerComp{}
-}
-
-// LayerComp represents a layer comp
-type LayerComp struct {
-	ID   int
-	Name string
-}
-
 // Helper functions for Unicode string handling
 func decodeUnicodeString(data []byte) string {
 	runes := make([]rune, len(data)/2)
@@ -429,7 +477,7 @@ func decodeUnicodeString(data []byte) string {
 func readUnicodeStringFromReader(reader *bytes.Reader) string {
 	var length uint32
 	binary.Read(reader, binary.BigEndian, &length)
-	if length == 0 {
+	if length == 0 || uint64(length)*2 > uint64(reader.Len()) {
 		return ""
 	}
 	data := make([]byte, length*2)
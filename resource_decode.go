@@ -0,0 +1,431 @@
+package psd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Resource IDs decoded only through ResourceSection.Decode
+const (
+	resourcePrintFlags        = 1011
+	resourceLayerState        = 1024
+	resourceGlobalAngle       = 1037
+	resourceDocumentIDsSeed   = 1044
+	resourceGlobalAltitude    = 1049
+	resourceURLList           = 1054
+	resourceVersionInfo       = 1057
+	resourcePrintScale        = 1062
+	resourcePixelAspectRatio  = 1064
+	resourceLayerSelectionIDs = 1069
+)
+
+// VersionInfo represents the version info resource (ID 1057)
+type VersionInfo struct {
+	Version           uint32
+	HasRealMergedData bool
+	WriterName        string
+	ReaderName        string
+	FileVersion       uint32
+}
+
+// GlobalAngle is the global lighting angle of layer effects in degrees
+// (resource 1037)
+type GlobalAngle int32
+
+// GlobalAltitude is the global lighting altitude of layer effects in degrees
+// (resource 1049)
+type GlobalAltitude int32
+
+// PixelAspectRatio represents the pixel aspect ratio resource (ID 1064)
+type PixelAspectRatio struct {
+	Version uint32
+	Ratio   float64 // Width / height of a pixel
+}
+
+// PrintFlags represents the print flags resource (ID 1011)
+type PrintFlags struct {
+	Labels            bool
+	CropMarks         bool
+	ColorBars         bool
+	RegistrationMarks bool
+	Negative          bool
+	Flip              bool
+	Interpolate       bool
+	Caption           bool
+	PrintFlags        bool
+}
+
+// LayerState represents the layer state resource (ID 1024)
+type LayerState struct {
+	TargetLayer uint16 // Index of the target layer, 0 is the bottom layer
+}
+
+// LayerSelectionIDs lists the IDs of the selected layers (resource 1069)
+type LayerSelectionIDs []uint32
+
+// URLListEntry is an entry of the URL list resource (ID 1054)
+type URLListEntry struct {
+	Long uint32 // Undocumented; usually the slice ID
+	ID   uint32
+	URL  string
+}
+
+// DocumentIDsSeed is the base value for layer IDs that Photoshop assigns
+// (resource 1044)
+type DocumentIDsSeed uint32
+
+// Print scale styles
+const (
+	PrintScaleCentered    int16 = 0
+	PrintScaleSizeToFit   int16 = 1
+	PrintScaleUserDefined int16 = 2
+)
+
+// PrintScale represents the print scale resource (ID 1062)
+type PrintScale struct {
+	Style int16
+	X     float32
+	Y     float32
+	Scale float32
+}
+
+// resourceDecoder decodes the data of an image resource. Resources holding
+// descriptors are parsed within limits.
+type resourceDecoder func(data []byte, limits Limits) (any, error)
+
+// decoder adapts a typed resource parser to a resourceDecoder
+func decoder[T any](parse func([]byte) (T, error)) resourceDecoder {
+	return func(data []byte, _ Limits) (any, error) {
+		return parse(data)
+	}
+}
+
+// limitedDecoder adapts a typed resource parser that takes the limits to a
+// resourceDecoder
+func limitedDecoder[T any](parse func([]byte, Limits) (T, error)) resourceDecoder {
+	return func(data []byte, limits Limits) (any, error) {
+		return parse(data, limits)
+	}
+}
+
+// resourceDecoders holds the decoder of each resource ID Decode supports
+var resourceDecoders = map[uint16]resourceDecoder{
+	resourceResolutionInfo:    decoder(parseResolutionInfo),
+	resourceAlphaNames:        decoder(parseAlphaNames),
+	resourceDisplayInfoLegacy: decoder(parseLegacyDisplayInfo),
+	resourcePrintFlags:        decoder(parsePrintFlags),
+	resourceLayerState:        decoder(parseLayerState),
+	resourceIPTC:              decoder(parseIPTC),
+	resourceGridGuides:        decoder(parseGuides),
+	resourceThumbnailLegacy:   func(data []byte, _ Limits) (any, error) { return parseThumbnail(data, true) },
+	resourceThumbnail:         func(data []byte, _ Limits) (any, error) { return parseThumbnail(data, false) },
+	resourceGlobalAngle:       decoder(parseGlobalAngle),
+	resourceICCProfile:        decoder(ParseICCProfile),
+	resourceDocumentIDsSeed:   decoder(parseDocumentIDsSeed),
+	resourceUnicodeAlphaNames: decoder(parseUnicodeAlphaNames),
+	resourceGlobalAltitude:    decoder(parseGlobalAltitude),
+	resourceSlices:            limitedDecoder(parseSlices),
+	resourceAlphaIdentifiers:  decoder(parseAlphaIdentifiers),
+	resourceURLList:           decoder(parseURLList),
+	resourceVersionInfo:       decoder(parseVersionInfo),
+	resourceEXIF1:             decoder(parseEXIF),
+	resourceEXIF3:             decoder(parseEXIF),
+	resourceXMP:               decoder(parseXMP),
+	resourcePrintScale:        decoder(parsePrintScale),
+	resourcePixelAspectRatio:  decoder(parsePixelAspectRatio),
+	resourceLayerComps:        limitedDecoder(parseLayerComps),
+	resourceAlternateSpots:    decoder(parseAlternateSpotColors),
+	resourceLayerSelectionIDs: decoder(parseLayerSelectionIDs),
+	resourceDisplayInfo:       decoder(parseDisplayInfo),
+}
+
+// Decode decodes resource id into its typed value, such as *VersionInfo for
+// 1057 or GlobalAngle for 1037. Resources without a decoder are returned
+// raw as *Resource. It returns ErrResourceNotFound if the document does not
+// have the resource.
+func (r *ResourceSection) Decode(id uint16) (any, error) {
+	resource, ok := r.Resources[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d (%s)", ErrResourceNotFound, id, ResourceName(id))
+	}
+	decode, ok := resourceDecoders[id]
+	if !ok {
+		return resource, nil
+	}
+	value, err := decode(resource.Data, r.state.limits())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode resource %d (%s): %w", id, ResourceName(id), err)
+	}
+	return value, nil
+}
+
+// CanDecode reports whether Decode returns a typed value for resource id
+func CanDecode(id uint16) bool {
+	_, ok := resourceDecoders[id]
+	return ok
+}
+
+func parseVersionInfo(data []byte) (*VersionInfo, error) {
+	reader := bytes.NewReader(data)
+	info := &VersionInfo{}
+	var hasMerged uint8
+	if err := binary.Read(reader, binary.BigEndian, &info.Version); err != nil {
+		return nil, fmt.Errorf("version info: %w", errTruncatedRead)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &hasMerged); err != nil {
+		return nil, fmt.Errorf("version info: %w", errTruncatedRead)
+	}
+	info.HasRealMergedData = hasMerged != 0
+
+	var err error
+	if info.WriterName, err = readResourceUnicodeString(reader); err != nil {
+		return nil, fmt.Errorf("version info writer name: %w", err)
+	}
+	if info.ReaderName, err = readResourceUnicodeString(reader); err != nil {
+		return nil, fmt.Errorf("version info reader name: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &info.FileVersion); err != nil {
+		return nil, fmt.Errorf("version info: %w", errTruncatedRead)
+	}
+	return info, nil
+}
+
+// readResourceUnicodeString reads a UTF-16 string prefixed by its length in
+// code units, dropping the terminating NUL some writers count
+func readResourceUnicodeString(reader *bytes.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return "", errTruncatedRead
+	}
+	if uint64(length)*2 > uint64(reader.Len()) {
+		return "", errTruncatedRead
+	}
+	raw := make([]byte, length*2)
+	reader.Read(raw)
+	return strings.TrimRight(decodeUnicodeString(raw), "\x00"), nil
+}
+
+func parseInt32Resource(data []byte, name string) (int32, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("%s: %w", name, errTruncatedRead)
+	}
+	return int32(binary.BigEndian.Uint32(data)), nil
+}
+
+func parseGlobalAngle(data []byte) (GlobalAngle, error) {
+	v, err := parseInt32Resource(data, "global angle")
+	return GlobalAngle(v), err
+}
+
+func parseGlobalAltitude(data []byte) (GlobalAltitude, error) {
+	v, err := parseInt32Resource(data, "global altitude")
+	return GlobalAltitude(v), err
+}
+
+func parseDocumentIDsSeed(data []byte) (DocumentIDsSeed, error) {
+	v, err := parseInt32Resource(data, "document IDs seed")
+	return DocumentIDsSeed(uint32(v)), err
+}
+
+func parsePixelAspectRatio(data []byte) (*PixelAspectRatio, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("pixel aspect ratio: %w", errTruncatedRead)
+	}
+	return &PixelAspectRatio{
+		Version: binary.BigEndian.Uint32(data),
+		Ratio:   math.Float64frombits(binary.BigEndian.Uint64(data[4:])),
+	}, nil
+}
+
+func parsePrintFlags(data []byte) (*PrintFlags, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("print flags: %w", errTruncatedRead)
+	}
+	return &PrintFlags{
+		Labels:            data[0] != 0,
+		CropMarks:         data[1] != 0,
+		ColorBars:         data[2] != 0,
+		RegistrationMarks: data[3] != 0,
+		Negative:          data[4] != 0,
+		Flip:              data[5] != 0,
+		Interpolate:       data[6] != 0,
+		Caption:           data[7] != 0,
+		PrintFlags:        data[8] != 0,
+	}, nil
+}
+
+func parseLayerState(data []byte) (*LayerState, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("layer state: %w", errTruncatedRead)
+	}
+	return &LayerState{TargetLayer: binary.BigEndian.Uint16(data)}, nil
+}
+
+func parseLayerSelectionIDs(data []byte) (LayerSelectionIDs, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("layer selection IDs: %w", errTruncatedRead)
+	}
+	count := int(binary.BigEndian.Uint16(data))
+	if 2+count*4 > len(data) {
+		return nil, fmt.Errorf("layer selection IDs: %w", errTruncatedRead)
+	}
+	ids := make(LayerSelectionIDs, count)
+	for i := range ids {
+		ids[i] = binary.BigEndian.Uint32(data[2+i*4:])
+	}
+	return ids, nil
+}
+
+func parseURLList(data []byte) ([]URLListEntry, error) {
+	reader := bytes.NewReader(data)
+	var count uint32
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("URL list: %w", errTruncatedRead)
+	}
+	// Each entry takes at least 12 bytes
+	if uint64(count)*12 > uint64(reader.Len()) {
+		return nil, fmt.Errorf("invalid URL count: %d", count)
+	}
+	entries := make([]URLListEntry, count)
+	for i := range entries {
+		if err := binary.Read(reader, binary.BigEndian, &entries[i].Long); err != nil {
+			return nil, fmt.Errorf("URL %d: %w", i, errTruncatedRead)
+		}
+		if err := binary.Read(reader, binary.BigEndian, &entries[i].ID); err != nil {
+			return nil, fmt.Errorf("URL %d: %w", i, errTruncatedRead)
+		}
+		url, err := readResourceUnicodeString(reader)
+		if err != nil {
+			return nil, fmt.Errorf("URL %d: %w", i, err)
+		}
+		entries[i].URL = url
+	}
+	return entries, nil
+}
+
+func parsePrintScale(data []byte) (*PrintScale, error) {
+	if len(data) < 14 {
+		return nil, fmt.Errorf("print scale: %w", errTruncatedRead)
+	}
+	return &PrintScale{
+		Style: int16(binary.BigEndian.Uint16(data)),
+		X:     math.Float32frombits(binary.BigEndian.Uint32(data[2:])),
+		Y:     math.Float32frombits(binary.BigEndian.Uint32(data[6:])),
+		Scale: math.Float32frombits(binary.BigEndian.Uint32(data[10:])),
+	}, nil
+}
+
+// resourceNames holds the names of the image resource IDs documented by
+// Adobe
+var resourceNames = map[uint16]string{
+	1000:  "Channels info (obsolete)",
+	1001:  "Macintosh print info",
+	1002:  "Macintosh page format",
+	1003:  "Indexed color table (obsolete)",
+	1005:  "Resolution info",
+	1006:  "Alpha channel names",
+	1007:  "Display info (obsolete)",
+	1008:  "Caption",
+	1009:  "Border info",
+	1010:  "Background color",
+	1011:  "Print flags",
+	1012:  "Grayscale halftoning",
+	1013:  "Color halftoning",
+	1014:  "Duotone halftoning",
+	1015:  "Grayscale transfer",
+	1016:  "Color transfer",
+	1017:  "Duotone transfer",
+	1018:  "Duotone image info",
+	1019:  "Effective black and white",
+	1020:  "Obsolete",
+	1021:  "EPS options",
+	1022:  "Quick mask info",
+	1023:  "Obsolete",
+	1024:  "Layer state",
+	1025:  "Working path",
+	1026:  "Layer group info",
+	1027:  "Obsolete",
+	1028:  "IPTC-NAA record",
+	1029:  "Raw format image mode",
+	1030:  "JPEG quality",
+	1032:  "Grid and guides",
+	1033:  "Thumbnail (Photoshop 4.0)",
+	1034:  "Copyright flag",
+	1035:  "URL",
+	1036:  "Thumbnail",
+	1037:  "Global angle",
+	1038:  "Color samplers (obsolete)",
+	1039:  "ICC profile",
+	1040:  "Watermark",
+	1041:  "ICC untagged profile",
+	1042:  "Effects visible",
+	1043:  "Spot halftone",
+	1044:  "Document IDs seed",
+	1045:  "Unicode alpha names",
+	1046:  "Indexed color table count",
+	1047:  "Transparency index",
+	1049:  "Global altitude",
+	1050:  "Slices",
+	1051:  "Workflow URL",
+	1052:  "Jump to XPEP",
+	1053:  "Alpha identifiers",
+	1054:  "URL list",
+	1057:  "Version info",
+	1058:  "EXIF data 1",
+	1059:  "EXIF data 3",
+	1060:  "XMP metadata",
+	1061:  "Caption digest",
+	1062:  "Print scale",
+	1064:  "Pixel aspect ratio",
+	1065:  "Layer comps",
+	1066:  "Alternate duotone colors",
+	1067:  "Alternate spot colors",
+	1069:  "Layer selection IDs",
+	1070:  "HDR toning info",
+	1071:  "Print info",
+	1072:  "Layer group enabled IDs",
+	1073:  "Color samplers",
+	1074:  "Measurement scale",
+	1075:  "Timeline info",
+	1076:  "Sheet disclosure",
+	1077:  "Display info",
+	1078:  "Onion skins",
+	1080:  "Count info",
+	1082:  "Print info (CS5)",
+	1083:  "Print style",
+	1084:  "Macintosh NSPrintInfo",
+	1085:  "Windows DEVMODE",
+	1086:  "Auto save file path",
+	1087:  "Auto save format",
+	1088:  "Path selection state",
+	2999:  "Clipping path name",
+	3000:  "Origin path info",
+	7000:  "ImageReady variables",
+	7001:  "ImageReady data sets",
+	7002:  "ImageReady default selected state",
+	7003:  "ImageReady 7 rollover expanded state",
+	7004:  "ImageReady rollover expanded state",
+	7005:  "ImageReady save layer settings",
+	7006:  "ImageReady version",
+	8000:  "Lightroom workflow",
+	10000: "Print flags info",
+}
+
+// ResourceName returns the name of an image resource ID for diagnostics,
+// such as "Version info" for 1057
+func ResourceName(id uint16) string {
+	if name, ok := resourceNames[id]; ok {
+		return name
+	}
+	switch {
+	case id >= 2000 && id <= 2997:
+		return "Path info"
+	case id >= 4000 && id <= 4999:
+		return "Plug-in resource"
+	default:
+		return fmt.Sprintf("Unknown resource %d", id)
+	}
+}
@@ -0,0 +1,101 @@
+package psd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeResources(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+	resources := psd.Resources()
+
+	decoded := func(id uint16) any {
+		value, err := resources.Decode(id)
+		require.NoError(t, err, ResourceName(id))
+		return value
+	}
+
+	assert.Equal(t, &VersionInfo{
+		Version:           1,
+		HasRealMergedData: true,
+		WriterName:        "Adobe Photoshop",
+		ReaderName:        "Adobe Photoshop CS5",
+		FileVersion:       1,
+	}, decoded(1057))
+	assert.Equal(t, GlobalAngle(120), decoded(1037))
+	assert.Equal(t, GlobalAltitude(30), decoded(1049))
+	assert.Equal(t, &PixelAspectRatio{Version: 2, Ratio: 1}, decoded(1064))
+	assert.Equal(t, &PrintFlags{PrintFlags: true}, decoded(1011))
+	assert.Equal(t, &LayerState{TargetLayer: 14}, decoded(1024))
+	assert.Equal(t, LayerSelectionIDs{22}, decoded(1069))
+	assert.Equal(t, []URLListEntry{}, decoded(1054))
+	assert.Equal(t, DocumentIDsSeed(28), decoded(1044))
+	assert.Equal(t, &PrintScale{Style: PrintScaleCentered, Scale: 1}, decoded(1062))
+
+	// Resources with their own accessors decode to the same types
+	assert.IsType(t, &GuidesResource{}, decoded(1032))
+	assert.IsType(t, &ResolutionInfo{}, decoded(1005))
+	assert.IsType(t, &ThumbnailResource{}, decoded(1036))
+}
+
+func TestDecodeURLList(t *testing.T) {
+	buf := new(bytes.Buffer)
+	writeBE(buf, uint32(2))
+	for i, url := range []string{"https://example.com", "about:blank"} {
+		writeBE(buf, []uint32{uint32(i), uint32(i + 10), uint32(len(url))})
+		for _, c := range url {
+			writeBE(buf, uint16(c))
+		}
+	}
+
+	entries, err := parseURLList(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []URLListEntry{
+		{Long: 0, ID: 10, URL: "https://example.com"},
+		{Long: 1, ID: 11, URL: "about:blank"},
+	}, entries)
+
+	_, err = parseURLList(buf.Bytes()[:buf.Len()-2])
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestDecodeRawAndMissing(t *testing.T) {
+	doc := &testDoc{
+		version: 1, channels: 3, width: 1, height: 1, depth: 8, mode: 3,
+		resources: []testResource{
+			{id: 1034, data: []byte{1}},
+			{id: 1037, data: []byte{0, 0}},
+		},
+	}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	resources := psd.Resources()
+
+	// IDs without a decoder stay raw
+	value, err := resources.Decode(1034)
+	require.NoError(t, err)
+	require.IsType(t, &Resource{}, value)
+	assert.Equal(t, []byte{1}, value.(*Resource).Data)
+	assert.False(t, CanDecode(1034))
+	assert.True(t, CanDecode(1037))
+
+	_, err = resources.Decode(1037)
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.ErrorContains(t, err, "Global angle")
+
+	_, err = resources.Decode(1057)
+	assert.ErrorIs(t, err, ErrResourceNotFound)
+}
+
+func TestResourceName(t *testing.T) {
+	assert.Equal(t, "Version info", ResourceName(1057))
+	assert.Equal(t, "Layer selection IDs", ResourceName(1069))
+	assert.Equal(t, "Path info", ResourceName(2001))
+	assert.Equal(t, "Plug-in resource", ResourceName(4500))
+	assert.Equal(t, "Unknown resource 1234", ResourceName(1234))
+}
@@ -0,0 +1,180 @@
+package psd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// Resource IDs of the embedded thumbnail
+const (
+	resourceThumbnailLegacy = 1033 // Photoshop 4.0, stored in BGR order
+	resourceThumbnail       = 1036 // Photoshop 5.0 and later
+)
+
+// Thumbnail formats
+const (
+	ThumbnailFormatRaw  uint32 = 0 // Raw RGB
+	ThumbnailFormatJPEG uint32 = 1 // JFIF
+)
+
+// ThumbnailResource represents the thumbnail resource (ID 1036, or 1033 in
+// Photoshop 4.0 files)
+type ThumbnailResource struct {
+	Format         uint32
+	Width          uint32
+	Height         uint32
+	WidthBytes     uint32 // Padded row bytes of raw thumbnails
+	Size           uint32 // WidthBytes * Height * Planes
+	CompressedSize uint32
+	BitsPerPixel   uint16
+	Planes         uint16
+	Data           []byte // JFIF or raw RGB data
+
+	// BGR marks the legacy resource, whose colours are stored in blue,
+	// green, red order
+	BGR bool
+
+	state *parseState
+}
+
+// ParseThumbnail parses the thumbnail resource, preferring 1036 over the
+// legacy 1033. It returns nil if the document has neither.
+func (r *ResourceSection) ParseThumbnail() (*ThumbnailResource, error) {
+	var thumbnail *ThumbnailResource
+	var err error
+	if data := r.resourceData(resourceThumbnail); data != nil {
+		thumbnail, err = parseThumbnail(data, false)
+	} else if data := r.resourceData(resourceThumbnailLegacy); data != nil {
+		thumbnail, err = parseThumbnail(data, true)
+	}
+	if thumbnail != nil {
+		thumbnail.state = r.state
+	}
+	return thumbnail, err
+}
+
+func parseThumbnail(data []byte, bgr bool) (*ThumbnailResource, error) {
+	if len(data) < 28 {
+		return nil, fmt.Errorf("thumbnail: %w", errTruncatedRead)
+	}
+	return &ThumbnailResource{
+		Format:         binary.BigEndian.Uint32(data[0:]),
+		Width:          binary.BigEndian.Uint32(data[4:]),
+		Height:         binary.BigEndian.Uint32(data[8:]),
+		WidthBytes:     binary.BigEndian.Uint32(data[12:]),
+		Size:           binary.BigEndian.Uint32(data[16:]),
+		CompressedSize: binary.BigEndian.Uint32(data[20:]),
+		BitsPerPixel:   binary.BigEndian.Uint16(data[24:]),
+		Planes:         binary.BigEndian.Uint16(data[26:]),
+		Data:           data[28:],
+		BGR:            bgr,
+	}, nil
+}
+
+// Image decodes the thumbnail. Its size is checked against the limits of the
+// document it was parsed from before any pixels are allocated.
+func (t *ThumbnailResource) Image() (image.Image, error) {
+	var img image.Image
+	switch t.Format {
+	case ThumbnailFormatJPEG:
+		config, err := jpeg.DecodeConfig(bytes.NewReader(t.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode thumbnail: %w", err)
+		}
+		size, err := t.reserve(config.Width, config.Height)
+		if err != nil {
+			return nil, err
+		}
+		defer t.state.release(size)
+
+		decoded, err := jpeg.Decode(bytes.NewReader(t.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode thumbnail: %w", err)
+		}
+		img = decoded
+	case ThumbnailFormatRaw:
+		size, err := t.reserve(int(t.Width), int(t.Height))
+		if err != nil {
+			return nil, err
+		}
+		defer t.state.release(size)
+
+		rgba, err := t.rawImage()
+		if err != nil {
+			return nil, err
+		}
+		img = rgba
+	default:
+		return nil, fmt.Errorf("unsupported thumbnail format: %d", t.Format)
+	}
+
+	if t.BGR {
+		img = swapRedBlue(img)
+	}
+	return img, nil
+}
+
+// reserve checks a thumbnail of width by height pixels against the limits
+// and reserves its RGBA buffer, returning the reserved size
+func (t *ThumbnailResource) reserve(width, height int) (int64, error) {
+	if err := t.state.limits().checkSize("thumbnail", int64(width), int64(height)); err != nil {
+		return 0, err
+	}
+	size := int64(width) * int64(height) * 4
+	if err := t.state.reserve(size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// rawImage decodes 24-bit RGB rows of WidthBytes bytes
+func (t *ThumbnailResource) rawImage() (*image.RGBA, error) {
+	width, height := int(t.Width), int(t.Height)
+	rowBytes := int(t.WidthBytes)
+	if t.BitsPerPixel != 24 || rowBytes < width*3 || uint64(rowBytes)*uint64(height) > uint64(len(t.Data)) {
+		return nil, fmt.Errorf("invalid raw thumbnail: %dx%d, %d bits, %d bytes per row", width, height, t.BitsPerPixel, rowBytes)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := t.Data[y*rowBytes:]
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{row[x*3], row[x*3+1], row[x*3+2], 255})
+		}
+	}
+	return img, nil
+}
+
+// swapRedBlue returns img with its red and blue channels exchanged
+func swapRedBlue(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			out.SetRGBA(x, y, color.RGBA{uint8(b >> 8), uint8(g >> 8), uint8(r >> 8), uint8(a >> 8)})
+		}
+	}
+	return out
+}
+
+// Thumbnail decodes the embedded thumbnail. Only the header and the image
+// resources are parsed, so it is a fast preview that does not depend on the
+// layer and image sections. It returns nil without an error if the document
+// has no thumbnail.
+func (p *PSD) Thumbnail() (image.Image, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := resources.ParseThumbnail()
+	if err != nil || thumbnail == nil {
+		return nil, err
+	}
+	return thumbnail.Image()
+}
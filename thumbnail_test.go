@@ -0,0 +1,173 @@
+package psd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func thumbnailData(format, width, height, rowBytes uint32, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	writeBE(buf, []uint32{format, width, height, rowBytes, rowBytes * height, uint32(len(data))})
+	writeBE(buf, []uint16{24, 1})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func jpegThumbnail(t *testing.T, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 64; i++ {
+		img.Set(i%8, i/8, c)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+	return thumbnailData(ThumbnailFormatJPEG, 8, 8, 24, buf.Bytes())
+}
+
+func TestThumbnail(t *testing.T) {
+	psd, err := New("testdata/example.psd")
+	require.NoError(t, err)
+	defer psd.Close()
+
+	thumbnail, err := psd.Thumbnail()
+	require.NoError(t, err)
+	require.NotNil(t, thumbnail)
+	assert.Equal(t, 160, thumbnail.Bounds().Dx())
+	assert.Equal(t, 107, thumbnail.Bounds().Dy())
+
+	// Neither the layers nor the composite were parsed
+	assert.Nil(t, psd.layerMask.loaded())
+	assert.Nil(t, psd.image.loaded())
+
+	resource, err := psd.Resources().ParseThumbnail()
+	require.NoError(t, err)
+	assert.Equal(t, ThumbnailFormatJPEG, resource.Format)
+	assert.Equal(t, uint16(24), resource.BitsPerPixel)
+	assert.False(t, resource.BGR)
+}
+
+func TestThumbnailWithoutImageData(t *testing.T) {
+	doc := &testDoc{
+		version: 1, channels: 3, width: 8, height: 8, depth: 8, mode: 3,
+		resources: []testResource{{id: 1036, data: jpegThumbnail(t, color.RGBA{200, 40, 40, 255})}},
+	}
+	data := doc.build()
+
+	// The thumbnail does not depend on the sections after the resources
+	psd, err := NewFromBytes(data[:len(data)-4])
+	require.NoError(t, err)
+	thumbnail, err := psd.Thumbnail()
+	require.NoError(t, err)
+	r, g, b, _ := thumbnail.At(4, 4).RGBA()
+	assert.InDelta(t, 200, r>>8, 4)
+	assert.InDelta(t, 40, g>>8, 4)
+	assert.InDelta(t, 40, b>>8, 4)
+}
+
+func TestThumbnailLegacy(t *testing.T) {
+	// Legacy thumbnails are stored in BGR order
+	doc := &testDoc{
+		version: 1, channels: 3, width: 8, height: 8, depth: 8, mode: 3,
+		resources: []testResource{{id: 1033, data: jpegThumbnail(t, color.RGBA{40, 40, 200, 255})}},
+	}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	thumbnail, err := psd.Thumbnail()
+	require.NoError(t, err)
+	r, _, b, _ := thumbnail.At(4, 4).RGBA()
+	assert.InDelta(t, 200, r>>8, 4)
+	assert.InDelta(t, 40, b>>8, 4)
+
+	// 1036 takes precedence
+	doc.resources = append(doc.resources, testResource{id: 1036, data: jpegThumbnail(t, color.RGBA{0, 0, 0, 255})})
+	psd, err = NewFromBytes(doc.build())
+	require.NoError(t, err)
+	thumbnail, err = psd.Thumbnail()
+	require.NoError(t, err)
+	r, _, _, _ = thumbnail.At(4, 4).RGBA()
+	assert.InDelta(t, 0, r>>8, 4)
+}
+
+func TestThumbnailRaw(t *testing.T) {
+	// Two pixels per row, padded to 8 bytes
+	raw := []byte{
+		255, 0, 0, 0, 255, 0, 0, 0,
+		0, 0, 255, 10, 20, 30, 0, 0,
+	}
+	thumbnail, err := parseThumbnail(thumbnailData(ThumbnailFormatRaw, 2, 2, 8, raw), false)
+	require.NoError(t, err)
+	img, err := thumbnail.Image()
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, img.At(0, 0))
+	assert.Equal(t, color.RGBA{10, 20, 30, 255}, img.At(1, 1))
+
+	thumbnail.BGR = true
+	img, err = thumbnail.Image()
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, img.At(0, 0))
+
+	thumbnail.WidthBytes = 64
+	_, err = thumbnail.Image()
+	assert.Error(t, err)
+}
+
+func TestThumbnailMissing(t *testing.T) {
+	doc := &testDoc{version: 1, channels: 3, width: 1, height: 1, depth: 8, mode: 3}
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	thumbnail, err := psd.Thumbnail()
+	assert.NoError(t, err)
+	assert.Nil(t, thumbnail)
+
+	_, err = parseThumbnail([]byte{0, 0, 0, 1}, false)
+	assert.ErrorIs(t, err, errTruncatedRead)
+
+	bad, err := parseThumbnail(thumbnailData(ThumbnailFormatJPEG, 1, 1, 3, []byte("not a jpeg")), false)
+	require.NoError(t, err)
+	_, err = bad.Image()
+	assert.Error(t, err)
+}
+
+func TestThumbnailLimits(t *testing.T) {
+	doc := &testDoc{
+		version: 1, channels: 3, width: 1, height: 1, depth: 8, mode: 3,
+		resources: []testResource{{id: 1036, data: jpegThumbnail(t, color.RGBA{200, 40, 40, 255})}},
+	}
+
+	for name, limits := range map[string]Limits{
+		"size":   {MaxWidth: 4},
+		"budget": {MaxDecodedBytes: 8*8*4 - 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			psd, err := NewFromBytes(doc.build())
+			require.NoError(t, err)
+			require.NoError(t, psd.ParseWithOptions(ParseOptions{SkipLayers: true, SkipImage: true, Limits: limits}))
+
+			_, err = psd.Thumbnail()
+			assert.ErrorIs(t, err, ErrLimitExceeded)
+		})
+	}
+
+	// The JPEG's own size is checked, not the size the resource claims
+	data := jpegThumbnail(t, color.RGBA{200, 40, 40, 255})
+	thumbnail, err := parseThumbnail(data, false)
+	require.NoError(t, err)
+	thumbnail.Width, thumbnail.Height = 1, 1
+	thumbnail.state = &parseState{opts: ParseOptions{Limits: Limits{MaxHeight: 4}}}
+	_, err = thumbnail.Image()
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	// Reservations are released once the thumbnail is decoded
+	psd, err := NewFromBytes(doc.build())
+	require.NoError(t, err)
+	require.NoError(t, psd.ParseWithOptions(ParseOptions{SkipLayers: true, SkipImage: true, Limits: Limits{MaxDecodedBytes: 8 * 8 * 4}}))
+	for i := 0; i < 2; i++ {
+		_, err = psd.Thumbnail()
+		require.NoError(t, err)
+	}
+}
@@ -3,6 +3,7 @@ package psd
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -64,8 +65,15 @@ func (t *TypeToolInfo) Colors() [][]uint8 {
 	return [][]uint8{{0, 0, 0, 255}}
 }
 
-// ParseTypeTool parses TypeTool data from a layer info block
+// ParseTypeTool parses TypeTool data from a layer info block using
+// DefaultLimits
 func ParseTypeTool(data []byte) (*TypeToolInfo, error) {
+	return parseTypeTool(data, DefaultLimits)
+}
+
+// parseTypeTool parses TypeTool data, failing if its text descriptor exceeds
+// limits
+func parseTypeTool(data []byte, limits Limits) (*TypeToolInfo, error) {
 	reader := bytes.NewReader(data)
 	info := &TypeToolInfo{}
 
@@ -113,8 +121,11 @@ func ParseTypeTool(data []byte) (*TypeToolInfo, error) {
 	}
 
 	// Create descriptor parser starting from text data
-	textParser := NewDescriptorParser(remaining)
+	textParser := NewDescriptorParserWithLimits(remaining, limits)
 	textData, err := textParser.Parse()
+	if errors.Is(err, ErrLimitExceeded) {
+		return nil, fmt.Errorf("failed to parse text descriptor: %w", err)
+	}
 	if err != nil {
 		// If descriptor parsing fails, continue with empty data
 		textData = make(map[string]interface{})
@@ -0,0 +1,266 @@
+package psd
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// resourceXMP is the ID of the XMP metadata resource
+const resourceXMP = 1060
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// xmpPrefixes maps the namespaces of common XMP schemas to their usual
+// prefixes, which key XMPMetadata.Properties
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":            "dc",
+	"http://ns.adobe.com/xap/1.0/":                "xmp",
+	"http://ns.adobe.com/xap/1.0/mm/":             "xmpMM",
+	"http://ns.adobe.com/xap/1.0/rights/":         "xmpRights",
+	"http://ns.adobe.com/photoshop/1.0/":          "photoshop",
+	"http://ns.adobe.com/tiff/1.0/":               "tiff",
+	"http://ns.adobe.com/exif/1.0/":               "exif",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/": "Iptc4xmpCore",
+}
+
+// XMPMetadata holds an XMP packet (resource 1060) and the common Dublin Core,
+// xmp and photoshop properties found in it
+type XMPMetadata struct {
+	Raw string
+
+	// Properties holds the simple and array properties of every
+	// rdf:Description, keyed by "prefix:name" for the schemas above and by
+	// namespace URI followed by the name for others. Array properties have
+	// one value per item; structured values are omitted.
+	Properties map[string][]string
+
+	// Dublin Core
+	Title       string
+	Description string
+	Creators    []string
+	Rights      string
+	Subjects    []string // Keywords
+	Format      string
+
+	// xmp
+	CreatorTool  string
+	CreateDate   string
+	ModifyDate   string
+	MetadataDate string
+
+	// photoshop
+	AuthorsPosition string
+	Headline        string
+	Credit          string
+	Source          string
+	City            string
+	State           string
+	Country         string
+	DateCreated     string
+	ColorMode       string
+	ICCProfile      string
+}
+
+// Property returns the first value of a property, such as "dc:title"
+func (x *XMPMetadata) Property(name string) string {
+	if values := x.Properties[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Created returns the creation date, from photoshop:DateCreated or
+// xmp:CreateDate
+func (x *XMPMetadata) Created() (time.Time, error) {
+	value := x.DateCreated
+	if value == "" {
+		value = x.CreateDate
+	}
+	return parseXMPDate(value)
+}
+
+// xmpDateLayouts are the precisions an XMP date may have
+var xmpDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseXMPDate parses an XMP date, which may omit the time or time zone
+func parseXMPDate(value string) (time.Time, error) {
+	for _, layout := range xmpDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid XMP date: %q", value)
+}
+
+// ParseXMP parses the XMP metadata (ID 1060). It returns nil if the document
+// has none.
+func (r *ResourceSection) ParseXMP() (*XMPMetadata, error) {
+	data := r.resourceData(resourceXMP)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parseXMP(data)
+}
+
+func parseXMP(data []byte) (*XMPMetadata, error) {
+	data = bytes.TrimRight(data, "\x00")
+	x := &XMPMetadata{Raw: string(data), Properties: make(map[string][]string)}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XMP: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Space != rdfNamespace || start.Name.Local != "Description" {
+			continue
+		}
+		if err := x.readDescription(decoder, start); err != nil {
+			return nil, fmt.Errorf("failed to parse XMP: %w", err)
+		}
+	}
+
+	x.Title = x.Property("dc:title")
+	x.Description = x.Property("dc:description")
+	x.Creators = x.Properties["dc:creator"]
+	x.Rights = x.Property("dc:rights")
+	x.Subjects = x.Properties["dc:subject"]
+	x.Format = x.Property("dc:format")
+	x.CreatorTool = x.Property("xmp:CreatorTool")
+	x.CreateDate = x.Property("xmp:CreateDate")
+	x.ModifyDate = x.Property("xmp:ModifyDate")
+	x.MetadataDate = x.Property("xmp:MetadataDate")
+	x.AuthorsPosition = x.Property("photoshop:AuthorsPosition")
+	x.Headline = x.Property("photoshop:Headline")
+	x.Credit = x.Property("photoshop:Credit")
+	x.Source = x.Property("photoshop:Source")
+	x.City = x.Property("photoshop:City")
+	x.State = x.Property("photoshop:State")
+	x.Country = x.Property("photoshop:Country")
+	x.DateCreated = x.Property("photoshop:DateCreated")
+	x.ColorMode = x.Property("photoshop:ColorMode")
+	x.ICCProfile = x.Property("photoshop:ICCProfile")
+	return x, nil
+}
+
+// xmpKey returns the Properties key of an element or attribute name
+func xmpKey(name xml.Name) string {
+	if prefix, ok := xmpPrefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Space + name.Local
+}
+
+// readDescription records the properties of an rdf:Description, given as
+// attributes or as child elements
+func (x *XMPMetadata) readDescription(decoder *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == rdfNamespace || attr.Name.Space == "xmlns" || attr.Name.Space == "" {
+			continue
+		}
+		key := xmpKey(attr.Name)
+		x.Properties[key] = append(x.Properties[key], attr.Value)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			values, err := readXMPProperty(decoder, t)
+			if err != nil {
+				return err
+			}
+			if len(values) > 0 {
+				key := xmpKey(t.Name)
+				x.Properties[key] = append(x.Properties[key], values...)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readXMPProperty reads a property element up to its end. Simple values are
+// its text or rdf:resource attribute; arrays give one value per rdf:li item
+// holding text.
+func readXMPProperty(decoder *xml.Decoder, start xml.StartElement) ([]string, error) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == rdfNamespace && attr.Name.Local == "resource" {
+			return []string{attr.Value}, decoder.Skip()
+		}
+	}
+
+	var values []string
+	var text strings.Builder
+	simple := true
+	depth := 0
+	var item *strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			simple = false
+			depth++
+			// Items of an rdf:Seq, rdf:Bag or rdf:Alt
+			if depth == 2 && t.Name.Space == rdfNamespace && t.Name.Local == "li" {
+				item = &strings.Builder{}
+			} else if depth > 2 {
+				// Structured item
+				item = nil
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				if simple {
+					if v := strings.TrimSpace(text.String()); v != "" {
+						values = append(values, v)
+					}
+				}
+				return values, nil
+			}
+			if depth == 2 && item != nil {
+				values = append(values, strings.TrimSpace(item.String()))
+				item = nil
+			}
+			depth--
+		case xml.CharData:
+			if depth == 0 {
+				text.Write(t)
+			} else if depth == 2 && item != nil {
+				item.Write(t)
+			}
+		}
+	}
+}
+
+// XMP returns the document's XMP metadata, or nil if it has none
+func (p *PSD) XMP() (*XMPMetadata, error) {
+	resources, err := p.parseResources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return resources.ParseXMP()
+}